@@ -0,0 +1,3 @@
+#!/usr/bin/env bash
+sleep 10 &
+echo started
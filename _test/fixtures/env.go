@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	wd, _ := os.Getwd()
+	fmt.Println(filepath.Base(wd))
+	for _, k := range os.Args[1:] {
+		v, ok := os.LookupEnv(k)
+		fmt.Printf("%s=%s %t\n", k, v, ok)
+	}
+}
+
+// vim: set filetype=go:
@@ -0,0 +1,9 @@
+package main
+
+import "os"
+
+//go:generate sh -c "cp exit.go.in exit_gen.go && echo generated >> generate.log"
+
+func main() {
+	os.Exit(exitCode)
+}
@@ -0,0 +1,10 @@
+// gos:go 1.99
+package main
+
+import "os"
+
+func main() {
+	os.Exit(15)
+}
+
+// vim: set filetype=go:
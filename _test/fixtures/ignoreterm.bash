@@ -0,0 +1,3 @@
+#!/usr/bin/env bash
+trap "" TERM
+sleep 10
@@ -0,0 +1,2 @@
+#!/usr/bin/env bash
+ps -o pgid= -p $$ | tr -d " "
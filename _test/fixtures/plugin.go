@@ -0,0 +1,14 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+func Main(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fmt.Fprint(stdout, "STDOUT: Exiting 15")
+	fmt.Fprint(stderr, "STDERR: Exiting 15")
+	return 15
+}
+
+// vim: set filetype=go:
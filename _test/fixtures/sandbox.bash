@@ -0,0 +1,5 @@
+#!/usr/bin/env bash
+grep -c sandbox-init /proc/1/cmdline
+touch "$1/file" && echo "writable"
+touch "$2/file" 2>/dev/null || echo "read only"
+grep -c ':' /proc/net/dev
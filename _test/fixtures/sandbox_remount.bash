@@ -0,0 +1,6 @@
+#!/usr/bin/env bash
+# Try to undo the read only mount containing the path.
+m=$(findmnt -n -o TARGET -T "$1")
+mount -o remount,bind,rw "$m" 2>/dev/null && echo "remounted"
+umount "$m" 2>/dev/null && echo "unmounted"
+touch "$1/file" 2>/dev/null || echo "read only"
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/leeola/goscriptify/scriptinfo"
+)
+
+func main() {
+	fmt.Println(scriptinfo.Path())
+	fmt.Println(scriptinfo.Hash())
+	fmt.Println(scriptinfo.BuildTime().IsZero())
+	fmt.Println(scriptinfo.Version())
+}
+
+// vim: set filetype=go:
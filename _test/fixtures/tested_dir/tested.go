@@ -0,0 +1,11 @@
+package main
+
+import "os"
+
+func add(a, b int) int {
+	return a + b
+}
+
+func main() {
+	os.Exit(add(10, 5))
+}
@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestAdd(t *testing.T) {
+	if add(10, 5) != 15 {
+		t.Fatal("Expected 15")
+	}
+}
+
+func TestFail(t *testing.T) {
+	t.Fatal("Failing on purpose")
+}
+
+func TestSkip(t *testing.T) {
+	t.Skip("Skipping on purpose")
+}
@@ -0,0 +1,4 @@
+#!/usr/bin/env bash
+trap "exit 10" USR1
+echo -n ready
+while true; do sleep 0.05; done
@@ -0,0 +1,5 @@
+#!/usr/bin/env bash
+[ -t 0 ] && [ -t 1 ] && [ -t 2 ] && echo "is a tty"
+read line
+echo "got $line"
+stty size
@@ -0,0 +1,3 @@
+#!/usr/bin/env bash
+ulimit -n
+ulimit -v
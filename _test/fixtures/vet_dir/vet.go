@@ -0,0 +1,13 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Printf("%d", "not a number")
+	os.Exit(15)
+}
+
+// vim: set filetype=go:
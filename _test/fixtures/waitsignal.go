@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+	fmt.Printf("ready %d\n", os.Getpid())
+	<-sigs
+	fmt.Println("got signal")
+	os.Exit(4)
+}
+
+// vim: set filetype=go:
@@ -2,26 +2,77 @@ package goscriptify
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
 	"syscall"
+	"time"
+
+	"github.com/leeola/goscriptify/utils"
 )
 
+// DefaultBuildNotice is how long a build may take before a compiling
+// notice is printed, when ScriptOptions.BuildNotice is zero.
+const DefaultBuildNotice = 2 * time.Second
+
 type BuildError struct {
-	Exit    int
+	Exit int
+
+	// Message is the go tool output. It's empty if the output was
+	// already streamed to BuildOptions.Stderr, see Verbose.
 	Message string
 }
 
 func (e *BuildError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("Go build error: exit status %d\n", e.Exit)
+	}
 	return fmt.Sprintf("Go build error:\n\n%s", e.Message)
 }
 
+// BuildOptions controls how the go tool is run when building.
+type BuildOptions struct {
+	// Stderr receives the go tool output as it is written, if Verbose.
+	Stderr io.Writer
+
+	// Verbose streams the go tool output to Stderr, rather than
+	// returning it within a BuildError when the build fails.
+	Verbose bool
+
+	// Flags are additional flags for go build, eg "-x" or "-v".
+	Flags []string
+
+	// Go is the go command to build with. If empty, the go command
+	// found in $PATH is used.
+	Go string
+
+	// Env is added to the environment of the go command, eg
+	// "CGO_ENABLED=0".
+	Env []string
+}
+
 // BuildDir builds the directory to the destination.
 //
 // Currently just using the go runtime to build, for simplicity.
 func BuildDir(dst string, dir string) error {
+	return BuildDirContext(context.Background(), dst, dir)
+}
+
+// BuildDirContext is BuildDir, stopping the build if ctx is done before
+// it completes.
+func BuildDirContext(ctx context.Context, dst string, dir string) error {
+	return BuildDirWithOpts(ctx, dst, dir, BuildOptions{})
+}
+
+// BuildDirWithOpts builds the directory to the destination, with the
+// given build options.
+func BuildDirWithOpts(ctx context.Context, dst string, dir string,
+	opts BuildOptions) error {
 	// If the dst is not absolute, make it relative to the cwd.
 	// This is needed because setting `cmd.Dir = dir` will cause the output
 	// to be relative to the cmd.Dir, not this process Cwd.
@@ -30,37 +81,27 @@ func BuildDir(dst string, dir string) error {
 		return err
 	}
 
-	cmd := exec.Command("go", "build", "-o", dst, ".")
-	cmd.Dir = dir
-
-	// Go returns build error output on the stderr, so we're storing it
-	// in case we need it. If needed, it will be returned inside of the
-	// BuildError
-	var stderr bytes.Buffer
-	defer stderr.Reset()
-	cmd.Stderr = &stderr
-
-	err = cmd.Run()
-	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				return &BuildError{
-					Exit:    status.ExitStatus(),
-					Message: stderr.String(),
-				}
-			}
-		}
-		// If it's not an execerr or we can't get the status, return err
-		return err
-	}
-
-	return nil
+	args := append([]string{"build", "-o", dst}, opts.Flags...)
+	return goBuild(ctx, dir, append(args, "."), opts)
 }
 
 // BuildFiles builds the given sources to the destination
 //
 // Currently just using the go runtime to build, for simplicity.
 func BuildFiles(dst string, srcs []string) error {
+	return BuildFilesContext(context.Background(), dst, srcs)
+}
+
+// BuildFilesContext is BuildFiles, stopping the build if ctx is done
+// before it completes.
+func BuildFilesContext(ctx context.Context, dst string, srcs []string) error {
+	return BuildFilesWithOpts(ctx, dst, srcs, BuildOptions{})
+}
+
+// BuildFilesWithOpts builds the given sources to the destination, with
+// the given build options.
+func BuildFilesWithOpts(ctx context.Context, dst string, srcs []string,
+	opts BuildOptions) error {
 	// Becuase Go's builder can return some vague errors, lets do some
 	// simple sanity checks.
 	for _, s := range srcs {
@@ -69,23 +110,33 @@ func BuildFiles(dst string, srcs []string) error {
 		}
 	}
 
-	args := append([]string{"build", "-o", dst}, srcs...)
-	cmd := exec.Command("go", args...)
+	args := append([]string{"build", "-o", dst}, opts.Flags...)
+	return goBuild(ctx, "", append(args, srcs...), opts)
+}
 
+// goBuild runs the go tool with the given args from dir, returning
+// a BuildError if the tool fails.
+func goBuild(ctx context.Context, dir string, args []string,
+	opts BuildOptions) error {
 	// Go returns build error output on the stderr, so we're storing it
 	// in case we need it. If needed, it will be returned inside of the
 	// BuildError
 	var stderr bytes.Buffer
 	defer stderr.Reset()
-	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	err := runGo(ctx, "build", dir, args, opts, nil, &stderr)
 	if err != nil {
 		if exiterr, ok := err.(*exec.ExitError); ok {
 			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+				// Streamed output has already been seen, so it's not
+				// repeated by the error.
+				msg := stderr.String()
+				if streamsOutput(opts) {
+					msg = ""
+				}
 				return &BuildError{
 					Exit:    status.ExitStatus(),
-					Message: stderr.String(),
+					Message: msg,
 				}
 			}
 		}
@@ -95,3 +146,73 @@ func BuildFiles(dst string, srcs []string) error {
 
 	return nil
 }
+
+// runGo runs the go tool with the given args from dir, writing its
+// output to stdout and stderr. If opts.Verbose, the stderr output is
+// also streamed to opts.Stderr.
+//
+// If ctx ends the tool, the ctx error for the given op is returned.
+func runGo(ctx context.Context, op, dir string, args []string,
+	opts BuildOptions, stdout, stderr io.Writer) error {
+	goCmd := opts.Go
+	if goCmd == "" {
+		goCmd = "go"
+	}
+
+	cmd := exec.Command(goCmd, args...)
+	cmd.Dir = dir
+	if len(opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), opts.Env...)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if streamsOutput(opts) {
+		cmd.Stderr = io.MultiWriter(stderr, opts.Stderr)
+	}
+
+	err := startCmd(ctx, cmd, newGroup(ctx))
+	if err == nil {
+		err = waitCmd(ctx, cmd, DefaultGracePeriod)
+	}
+	if err != nil && err == ctx.Err() {
+		return ctxError(ctx, op)
+	}
+	return err
+}
+
+// streamsOutput returns whether the go tool output is streamed to
+// opts.Stderr as it's written.
+func streamsOutput(opts BuildOptions) bool {
+	return opts.Verbose && opts.Stderr != nil
+}
+
+// noticeSlowBuild prints a compiling notice for name to w, if w is
+// a terminal and the build has not finished within d. A negative d
+// disables the notice.
+//
+// The returned func must be called when the build has finished. Once it
+// returns, the notice has either been printed or never will be.
+func noticeSlowBuild(w io.Writer, name string, d time.Duration) (stop func()) {
+	if d < 0 || !utils.IsTerminal(w) {
+		return func() {}
+	}
+	if d == 0 {
+		d = DefaultBuildNotice
+	}
+
+	var mu sync.Mutex
+	stopped := false
+	t := time.AfterFunc(d, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !stopped {
+			fmt.Fprintf(w, "goscriptify: compiling %s…\n", name)
+		}
+	})
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = true
+		t.Stop()
+	}
+}
@@ -1,6 +1,8 @@
 package goscriptify
 
 import (
+	"bytes"
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -72,3 +74,49 @@ func TestBuildFiles(t *testing.T) {
 		So(buildErr.Error(), ShouldContainSubstring, "syntax error")
 	})
 }
+
+func TestBuildDirContext(t *testing.T) {
+	fixDir := filepath.Join("_test", "fixtures")
+	dst := filepath.Join("_test", "tmp", "bin")
+
+	Convey("Should not build with a cancelled context", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := BuildDirContext(ctx, dst, filepath.Join(fixDir, "exit15_dir"))
+		So(err, ShouldEqual, context.Canceled)
+	})
+}
+
+func TestBuildFilesWithOpts(t *testing.T) {
+	dst := filepath.Join("_test", "tmp", "bin")
+
+	Convey("Should stream go tool output when verbose", t, func() {
+		var stderr bytes.Buffer
+		src := filepath.Join("_test", "fixtures", "exit15.go")
+		err := BuildFilesWithOpts(context.Background(), dst, []string{src},
+			BuildOptions{Stderr: &stderr, Verbose: true, Flags: []string{"-x"}})
+		So(err, ShouldBeNil)
+		So(stderr.String(), ShouldContainSubstring, "WORK=")
+	})
+
+	Convey("Should not stream go tool output unless verbose", t, func() {
+		var stderr bytes.Buffer
+		src := filepath.Join("_test", "fixtures", "synerr.go")
+		err := BuildFilesWithOpts(context.Background(), dst, []string{src},
+			BuildOptions{Stderr: &stderr})
+		So(err, ShouldNotBeNil)
+		So(stderr.Len(), ShouldEqual, 0)
+	})
+
+	Convey("Should not repeat streamed output in the BuildError", t, func() {
+		var stderr bytes.Buffer
+		src := filepath.Join("_test", "fixtures", "synerr.go")
+		err := BuildFilesWithOpts(context.Background(), dst, []string{src},
+			BuildOptions{Stderr: &stderr, Verbose: true})
+		buildErr, ok := err.(*BuildError)
+		So(ok, ShouldBeTrue)
+		So(buildErr.Message, ShouldEqual, "")
+		So(buildErr.Error(), ShouldEqual, "Go build error: exit status 1\n")
+		So(stderr.String(), ShouldContainSubstring, "synerr.go")
+	})
+}
@@ -0,0 +1,169 @@
+package goscriptify
+
+import (
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CommandNotFoundError is returned when a command name does not match
+// exactly one main package.
+type CommandNotFoundError struct {
+	Root string
+	Name string
+
+	// The main packages matching Name, if it was ambiguous.
+	Matches []string
+
+	// The names of every command available within Root.
+	Available []string
+}
+
+func (e *CommandNotFoundError) Error() string {
+	if len(e.Matches) > 1 {
+		return fmt.Sprintf("Command %q is ambiguous in %s, matching:\n\t%s",
+			e.Name, e.Root, strings.Join(e.Matches, "\n\t"))
+	}
+	if len(e.Available) == 0 {
+		return fmt.Sprintf("Cannot find command %q in %s, it contains no "+
+			"main packages", e.Name, e.Root)
+	}
+	return fmt.Sprintf("Cannot find command %q in %s, available commands:"+
+		"\n\t%s", e.Name, e.Root, strings.Join(e.Available, "\n\t"))
+}
+
+// FindCommands returns the dir of every main package within root,
+// relative to root. Dirs named testdata or vendor, or beginning with
+// . or _, are skipped as the go tool would.
+func FindCommands(root string) ([]string, error) {
+	var dirs []string
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+
+		n := fi.Name()
+		if p != root && (n == "testdata" || n == "vendor" ||
+			strings.HasPrefix(n, ".") || strings.HasPrefix(n, "_")) {
+			return filepath.SkipDir
+		}
+
+		isMain, err := isMainPackage(p)
+		if err != nil {
+			return err
+		}
+		if isMain {
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			dirs = append(dirs, rel)
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+// FindCommand returns the dir of the main package within root matching
+// the given command name. The name is either the base name of the
+// package dir, such as "deploy" for "cmd/deploy", or its path relative
+// to root.
+//
+// If name matches no main package, or more than one, a
+// CommandNotFoundError is returned.
+func FindCommand(root, name string) (string, error) {
+	dirs, err := FindCommands(root)
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	for _, d := range dirs {
+		if d == filepath.Clean(name) {
+			return filepath.Join(root, d), nil
+		}
+		if commandName(root, d) == name {
+			matches = append(matches, d)
+		}
+	}
+
+	if len(matches) == 1 {
+		return filepath.Join(root, matches[0]), nil
+	}
+
+	available := make([]string, len(dirs))
+	for i, d := range dirs {
+		available[i] = commandName(root, d)
+	}
+	sort.Strings(available)
+
+	return "", &CommandNotFoundError{
+		Root:      root,
+		Name:      name,
+		Matches:   matches,
+		Available: available,
+	}
+}
+
+// RunCommandWithOpts finds the named command within root, and compiles
+// and runs it with the given options. Each command is given its own
+// bin, so each is cached independently.
+//
+// See FindCommand for how commands are named.
+func RunCommandWithOpts(root, name string, args []string,
+	opts ScriptOptions) (int, error) {
+	res, err := RunCommandContext(context.Background(), root, name, args, opts)
+	return res.status(), err
+}
+
+// RunCommandContext is RunCommandWithOpts, stopping the build or the
+// command if ctx is done (or opts.Timeout passes) before they complete.
+func RunCommandContext(ctx context.Context, root, name string, args []string,
+	opts ScriptOptions) (*RunResult, error) {
+	dir, err := FindCommand(root, name)
+	if err != nil {
+		return nil, err
+	}
+	return RunScriptDirContext(ctx, dir, args, opts)
+}
+
+// commandName returns the name of the command in dir, relative to root.
+func commandName(root, dir string) string {
+	if dir == "." {
+		abs, err := filepath.Abs(root)
+		if err == nil {
+			return filepath.Base(abs)
+		}
+	}
+	return filepath.Base(dir)
+}
+
+// isMainPackage returns whether dir contains a main package, judged by
+// the package clause of its non-test go files.
+func isMainPackage(dir string) (bool, error) {
+	srcs, err := dirSources(dir)
+	if err != nil {
+		return false, err
+	}
+
+	fset := token.NewFileSet()
+	for _, src := range srcs {
+		f, err := parser.ParseFile(fset, src, nil, parser.PackageClauseOnly)
+		if err != nil {
+			// Unparsable files are left for the go tool to report
+			continue
+		}
+		if f.Name.Name == "main" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
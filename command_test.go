@@ -0,0 +1,64 @@
+package goscriptify
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFindCommands(t *testing.T) {
+	root := filepath.Join("_test", "fixtures", "commands")
+
+	Convey("Should return every main package", t, func() {
+		dirs, err := FindCommands(root)
+		So(err, ShouldBeNil)
+		So(dirs, ShouldResemble, []string{
+			filepath.Join("cmd", "deploy"),
+			filepath.Join("cmd", "lint"),
+		})
+	})
+}
+
+func TestFindCommand(t *testing.T) {
+	root := filepath.Join("_test", "fixtures", "commands")
+
+	Convey("Should find a command by name", t, func() {
+		dir, err := FindCommand(root, "deploy")
+		So(err, ShouldBeNil)
+		So(dir, ShouldEqual, filepath.Join(root, "cmd", "deploy"))
+	})
+
+	Convey("Should find a command by path", t, func() {
+		dir, err := FindCommand(root, "cmd/lint")
+		So(err, ShouldBeNil)
+		So(dir, ShouldEqual, filepath.Join(root, "cmd", "lint"))
+	})
+
+	Convey("Should list the available commands if not found", t, func() {
+		_, err := FindCommand(root, "lib")
+		notFound, ok := err.(*CommandNotFoundError)
+		So(ok, ShouldBeTrue)
+		So(notFound.Available, ShouldResemble, []string{"deploy", "lint"})
+		So(err.Error(), ShouldContainSubstring, "deploy")
+	})
+}
+
+func TestRunCommandWithOpts(t *testing.T) {
+	root := filepath.Join("_test", "fixtures", "commands")
+	opts := ScriptOptions{
+		Temp:  filepath.Join("_test", "tmp"),
+		Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+	}
+
+	Convey("Should build and run each command", t, func() {
+		exit, err := RunCommandWithOpts(root, "deploy", []string{}, opts)
+		So(err, ShouldBeNil)
+		So(exit, ShouldEqual, 15)
+
+		exit, err = RunCommandWithOpts(root, "lint", []string{}, opts)
+		So(err, ShouldBeNil)
+		So(exit, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,345 @@
+package goscriptify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// compileMode is what a script is compiled into.
+type compileMode int
+
+const (
+	compileExec compileMode = iota
+	compilePlugin
+)
+
+// compiled is a script, or script dir, which has been compiled and is
+// ready to run.
+type compiled struct {
+	// The path of the compiled bin, or plugin.
+	Bin string
+
+	// Env is added to the environment of the script when it's run.
+	Env []string
+
+	// Script is the original script, or script dir, that was compiled.
+	// If compiled from multiple scripts, it's the first.
+	Script string
+
+	// Dir is the script's own directory, which it's run in when
+	// ScriptOptions.InScriptDir is set.
+	Dir string
+
+	// Cached is true if the bin was up to date, and not rebuilt.
+	Cached bool
+
+	// BuildTime is how long compiling, and vetting, took.
+	BuildTime time.Duration
+}
+
+// compileScripts copies, compiles and vets the given scripts with the
+// given options.
+func compileScripts(ctx context.Context, scripts []string, opts ScriptOptions,
+	mode compileMode) (*compiled, error) {
+	start := time.Now()
+	tc, err := compileToolchain(scripts, opts, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	// The toolchain version is part of the bin hash, so that a script
+	// built by one toolchain is never reused by another.
+	binDst, hash, err := GetBinDest(scripts, opts.Temp, tc.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Concurrent compiles of the same script share its generated sources
+	// and bin, so they take turns. Later turns find the bin up to date.
+	unlock, err := lockBin(binDst)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	srcDir := scriptSrcDir(binDst)
+	scriptPaths := newScriptSrcPaths(srcDir, scripts)
+	defer os.RemoveAll(srcDir)
+
+	err = copyScriptSrcs(srcDir, scriptPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make a slice of sources for the build command
+	srcs := make([]string, len(scriptPaths))
+	for i, s := range scriptPaths {
+		srcs[i] = s.Generated
+	}
+
+	c, bOpts, err := compileTarget(binDst, scripts, scripts, tc, opts, mode)
+	if err != nil {
+		return nil, err
+	}
+	if len(scripts) > 0 {
+		c.Script, c.Dir = scripts[0], filepath.Dir(scripts[0])
+	}
+
+	// In the future we will checksum the source(s), but for now we're
+	// just letting go handle the repeat build caching (if at all)
+	stop := noticeSlowBuild(opts.Stderr, strings.Join(scripts, " "),
+		opts.BuildNotice)
+	before := statBin(c.Bin)
+	err = BuildFilesWithOpts(ctx, c.Bin, srcs, bOpts)
+	err = originalBuildError(err, scriptPaths)
+	c.Cached = err == nil && isUnchanged(c.Bin, before)
+	stop()
+	if err == nil {
+		err = vetScripts(ctx, vetCachePath(binDst), scriptPaths, tc, opts)
+	}
+	if err == nil && opts.CoverDir != "" {
+		var files map[string]string
+		files, err = scriptCoverageFiles(scriptPaths)
+		if err == nil {
+			c.Env, err = prepareCoverage(opts.CoverDir, hash, tc, scripts,
+				files, !c.Cached)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.BuildTime = time.Since(start)
+	return c, nil
+}
+
+// compileDir generates, compiles and vets the given script dir with the
+// given options.
+func compileDir(ctx context.Context, dir string, opts ScriptOptions,
+	mode compileMode) (*compiled, error) {
+	start := time.Now()
+	srcs, err := dirSources(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	tc, err := compileToolchain(srcs, opts, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	binDst, hash, err := GetBinDest([]string{dir}, opts.Temp, tc.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Concurrent compiles of the same script share its generated sources
+	// and bin, so they take turns. Later turns find the bin up to date.
+	unlock, err := lockBin(binDst)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if opts.Generate {
+		err = generateDir(ctx, generateStampPath(binDst), dir, tc, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		// Generating may have added sources, which must be vetted.
+		srcs, err = dirSources(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c, bOpts, err := compileTarget(binDst, []string{dir}, srcs, tc, opts, mode)
+	if err != nil {
+		return nil, err
+	}
+	c.Script, c.Dir = dir, dir
+
+	// In the future we will checksum the source(s), but for now we're
+	// just letting go handle the repeat build caching (if at all)
+	stop := noticeSlowBuild(opts.Stderr, dir, opts.BuildNotice)
+	before := statBin(c.Bin)
+	err = BuildDirWithOpts(ctx, c.Bin, dir, bOpts)
+	c.Cached = err == nil && isUnchanged(c.Bin, before)
+	stop()
+	if err != nil {
+		return nil, err
+	}
+
+	err = vetDir(ctx, vetCachePath(binDst), dir, srcs, tc, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.CoverDir != "" {
+		files, err := dirCoverageFiles(ctx, dir, srcs, tc)
+		if err != nil {
+			return nil, err
+		}
+		c.Env, err = prepareCoverage(opts.CoverDir, hash, tc, []string{dir},
+			files, !c.Cached)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.BuildTime = time.Since(start)
+	return c, nil
+}
+
+// compileToolchain selects the toolchain to compile the given sources
+// with, for the given mode.
+func compileToolchain(srcs []string, opts ScriptOptions,
+	mode compileMode) (Toolchain, error) {
+	if mode == compilePlugin {
+		return pluginToolchain(srcs, opts)
+	}
+	return scriptToolchain(srcs, opts)
+}
+
+// compileTarget returns the compiled output for the bin, and the build
+// options to produce it. The original script paths, and the sources
+// to hash, are stamped into the output as its metadata.
+func compileTarget(binDst string, paths, srcs []string, tc Toolchain,
+	opts ScriptOptions, mode compileMode) (*compiled, BuildOptions, error) {
+	bOpts := opts.buildOptions(tc)
+
+	ldflags, err := metadataFlags(metadataPath(binDst), paths, srcs)
+	if err != nil {
+		return nil, bOpts, err
+	}
+	// Our flags are merged into any -ldflags of the user, which would
+	// otherwise replace them.
+	bOpts.Flags, err = withLdflags(ldflags, bOpts.Flags)
+	if err != nil {
+		return nil, bOpts, err
+	}
+
+	c := &compiled{Bin: binDst}
+	if mode == compilePlugin {
+		c.Bin, err = pluginPath(binDst, srcs)
+		if err != nil {
+			return nil, bOpts, err
+		}
+		flags, env := hostBuildSettings()
+		flags = append([]string{"-buildmode=plugin"}, flags...)
+		bOpts.Flags = append(flags, bOpts.Flags...)
+		bOpts.Env = append(env, bOpts.Env...)
+	}
+
+	return c, bOpts, nil
+}
+
+// statBin returns the FileInfo of p, or nil if it doesn't exist.
+func statBin(p string) os.FileInfo {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+// isUnchanged returns whether p existed before the given build, and is
+// still the same file. The go tool only touches an up to date build,
+// while a rebuild replaces it.
+func isUnchanged(p string, before os.FileInfo) bool {
+	after := statBin(p)
+	return before != nil && after != nil && os.SameFile(before, after)
+}
+
+// lockBin locks the given bin against being compiled concurrently, by
+// this or any other process, returning the func to unlock it. The lock
+// is held on a file beside the bin, which is left in place.
+func lockBin(binDst string) (unlock func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(binDst), 0777); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(binDst+".lock", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() { f.Close() }, nil
+}
+
+// scriptSrcDir returns the dir that the scripts of the given bin are
+// copied into to be built.
+func scriptSrcDir(binDst string) string {
+	return binDst + ".src"
+}
+
+// newScriptSrcPaths returns the ScriptPaths of the given scripts, copied
+// into the src dir. As go builds files from a single dir, every script
+// is copied, including those which are already go files. Each is named
+// for its original, with .go appended if it's missing.
+func newScriptSrcPaths(srcDir string, paths []string) []ScriptPath {
+	sps := make([]ScriptPath, len(paths))
+	used := map[string]bool{}
+	for i, p := range paths {
+		name := filepath.Base(p)
+		if filepath.Ext(name) != ".go" {
+			name += ".go"
+		}
+		// Scripts from different dirs may share a name.
+		if used[name] {
+			name = fmt.Sprintf("%d-%s", i, name)
+		}
+		used[name] = true
+
+		sps[i] = ScriptPath{
+			Original:  p,
+			Generated: filepath.Join(srcDir, name),
+			Clean:     true,
+		}
+	}
+	return sps
+}
+
+// copyScriptSrcs copies the scripts into a fresh src dir.
+func copyScriptSrcs(srcDir string, ps []ScriptPath) error {
+	if err := os.RemoveAll(srcDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(srcDir, 0777); err != nil {
+		return err
+	}
+	return CopyScripts(ps)
+}
+
+// originalBuildError replaces the generated script paths within the
+// message of a BuildError with their original paths.
+func originalBuildError(err error, ps []ScriptPath) error {
+	buildErr, ok := err.(*BuildError)
+	if !ok || buildErr.Message == "" {
+		return err
+	}
+
+	// The go tool names files relative to its working dir when it can.
+	var names []string
+	cwd, _ := os.Getwd()
+	for _, s := range ps {
+		if abs, err := filepath.Abs(s.Generated); err == nil {
+			names = append(names, abs, s.Original)
+			if rel, err := filepath.Rel(cwd, abs); err == nil {
+				names = append(names, rel, s.Original)
+			}
+		}
+		names = append(names, s.Generated, s.Original)
+	}
+	return &BuildError{
+		Exit:    buildErr.Exit,
+		Message: strings.NewReplacer(names...).Replace(buildErr.Message),
+	}
+}
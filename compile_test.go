@@ -0,0 +1,85 @@
+package goscriptify
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLockBin(t *testing.T) {
+	tmpDir := filepath.Join("_test", "tmp")
+	binDst := filepath.Join(tmpDir, "lockbin")
+
+	Convey("Should lock the bin against other processes", t, func() {
+		flock, err := exec.LookPath("flock")
+		if err != nil {
+			t.Skip("flock is not installed")
+		}
+
+		unlock, err := lockBin(binDst)
+		So(err, ShouldBeNil)
+		err = exec.Command(flock, "-n", binDst+".lock", "true").Run()
+		So(err, ShouldNotBeNil)
+
+		unlock()
+		err = exec.Command(flock, "-n", binDst+".lock", "true").Run()
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestNewScriptSrcPaths(t *testing.T) {
+	Convey("Should copy every script into the src dir", t, func() {
+		ps := newScriptSrcPaths("src", []string{
+			"a/Builder", "a/helpers.go", "b/Builder",
+		})
+		So(ps, ShouldResemble, []ScriptPath{
+			{Original: "a/Builder", Generated: "src/Builder.go", Clean: true},
+			{Original: "a/helpers.go", Generated: "src/helpers.go", Clean: true},
+			{Original: "b/Builder", Generated: "src/2-Builder.go", Clean: true},
+		})
+	})
+}
+
+func TestCompileSharedSources(t *testing.T) {
+	fixDir := filepath.Join("_test", "fixtures")
+	adder := filepath.Join(fixDir, "adder")
+	adderTest := filepath.Join(fixDir, "adder_test")
+	opts := ScriptOptions{
+		Temp:  filepath.Join("_test", "tmp"),
+		Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+	}
+
+	Convey("Should build script sets sharing a source concurrently", t,
+		func() {
+			var wg sync.WaitGroup
+			errs := make(chan error, 8)
+			for i := 0; i < 4; i++ {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					_, err := RunScriptsWithOpts([]string{adder}, nil, opts)
+					errs <- err
+				}()
+				go func() {
+					defer wg.Done()
+					_, err := RunScriptTests(context.Background(),
+						[]string{adder, adderTest}, []string{}, opts)
+					errs <- err
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				So(err, ShouldBeNil)
+			}
+
+			_, err := os.Stat(adder + ".go")
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+}
@@ -0,0 +1,233 @@
+package goscriptify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// ScriptRun is a script to be run by RunConcurrent.
+type ScriptRun struct {
+	// Label prefixes each line of output from the script. Empty uses the
+	// first script, or the Dir.
+	Label string
+
+	// Scripts are the scripts to compile and run, as RunScriptsContext.
+	Scripts []string
+
+	// Dir is a go package directory to compile and run instead of
+	// Scripts, as RunScriptDirContext.
+	Dir string
+
+	Args []string
+}
+
+// label returns the Label of the run, or its scripts if it has none.
+func (r ScriptRun) label() string {
+	switch {
+	case r.Label != "":
+		return r.Label
+	case r.Dir != "":
+		return r.Dir
+	case len(r.Scripts) > 0:
+		return r.Scripts[0]
+	}
+	return ""
+}
+
+// ConcurrentOptions controls how RunConcurrent runs scripts.
+type ConcurrentOptions struct {
+	// ScriptOptions are used to build and run each script. Stdin is
+	// ignored, as the scripts cannot share it.
+	ScriptOptions
+
+	// Workers is the most scripts to run at once. Zero uses the number
+	// of CPUs.
+	Workers int
+
+	// Color colors the label of each script, to tell them apart.
+	Color bool
+}
+
+// ScriptRunResult is how a ScriptRun of RunConcurrent exited.
+type ScriptRunResult struct {
+	Label string
+
+	// Result is how the script exited, or nil if Err is set.
+	Result *RunResult
+
+	// Err is any error building or running the script.
+	Err error
+}
+
+// Status returns the exit status of the script, or 1 if it failed to
+// build or run.
+func (r *ScriptRunResult) Status() int {
+	if r.Err != nil {
+		return 1
+	}
+	return r.Result.Status()
+}
+
+// labelColors are the ANSI colors cycled through for labels.
+var labelColors = []int{36, 33, 32, 35, 34, 31}
+
+// RunConcurrent compiles and runs the given scripts, up to
+// opts.Workers at once. Each line written to Stdout or Stderr by a
+// script is prefixed by its label.
+//
+// Scripts shared by several runs are compiled once, with the rest
+// reusing the compiled bin. Results are returned in the order of runs.
+// See WriteRunSummary and RunsStatus to summarize them.
+func RunConcurrent(ctx context.Context, runs []ScriptRun,
+	opts ConcurrentOptions) []*ScriptRunResult {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	width := 0
+	for _, r := range runs {
+		if n := len(r.label()); n > width {
+			width = n
+		}
+	}
+
+	// Lines from every script are written whole, under one lock.
+	var mu sync.Mutex
+	results := make([]*ScriptRunResult, len(runs))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
+	for i, r := range runs {
+		prefix := fmt.Sprintf("%-*s | ", width, r.label())
+		if opts.Color {
+			prefix = fmt.Sprintf("\x1b[%dm%s\x1b[0m", labelColors[i%len(
+				labelColors)], prefix)
+		}
+
+		sOpts := opts.ScriptOptions
+		sOpts.Stdin = nil
+		stdout := newPrefixWriter(&mu, opts.Stdout, prefix)
+		stderr := newPrefixWriter(&mu, opts.Stderr, prefix)
+		sOpts.Stdout, sOpts.Stderr = stdout, stderr
+
+		wg.Add(1)
+		go func(i int, r ScriptRun) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res := &ScriptRunResult{Label: r.label()}
+			if r.Dir != "" {
+				res.Result, res.Err = RunScriptDirContext(ctx, r.Dir, r.Args,
+					sOpts)
+			} else {
+				res.Result, res.Err = RunScriptsContext(ctx, r.Scripts, r.Args,
+					sOpts)
+			}
+			stdout.Flush()
+			stderr.Flush()
+			results[i] = res
+		}(i, r)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// WriteRunSummary writes a table of the exit status, or error, of each
+// result to w.
+func WriteRunSummary(w io.Writer, results []*ScriptRunResult) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			msg := strings.SplitN(r.Err.Error(), "\n", 2)[0]
+			fmt.Fprintf(tw, "%s\tfailed\t%s\n", r.Label, msg)
+		case r.Result.Signaled():
+			fmt.Fprintf(tw, "%s\texit %d\t%s\n", r.Label, r.Status(),
+				r.Result.Signal)
+		default:
+			fmt.Fprintf(tw, "%s\texit %d\t\n", r.Label, r.Status())
+		}
+	}
+	return tw.Flush()
+}
+
+// RunsStatus returns the first non-zero Status of the results, or 0 if
+// every script succeeded.
+func RunsStatus(results []*ScriptRunResult) int {
+	for _, r := range results {
+		if s := r.Status(); s != 0 {
+			return s
+		}
+	}
+	return 0
+}
+
+// prefixWriter prefixes each line written to w, writing only whole
+// lines under the shared lock so that concurrent writers don't
+// interleave within a line.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func newPrefixWriter(mu *sync.Mutex, w io.Writer,
+	prefix string) *prefixWriter {
+	if w == nil {
+		w = io.Discard
+	}
+	return &prefixWriter{mu: mu, w: w, prefix: prefix}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+
+	i := bytes.LastIndexByte(p.buf, '\n')
+	if i < 0 {
+		return len(b), nil
+	}
+
+	lines := p.buf[:i+1]
+	err := p.writeLines(lines)
+	p.buf = append(p.buf[:0], p.buf[i+1:]...)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush writes any unterminated last line, ending it.
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	err := p.writeLines(append(p.buf, '\n'))
+	p.buf = p.buf[:0]
+	return err
+}
+
+// writeLines writes the newline terminated lines, each prefixed.
+func (p *prefixWriter) writeLines(lines []byte) error {
+	var out bytes.Buffer
+	for len(lines) > 0 {
+		i := bytes.IndexByte(lines, '\n')
+		out.WriteString(p.prefix)
+		out.Write(lines[:i+1])
+		lines = lines[i+1:]
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.w.Write(out.Bytes())
+	return err
+}
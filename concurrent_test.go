@@ -0,0 +1,78 @@
+package goscriptify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRunConcurrent(t *testing.T) {
+	fixDir := filepath.Join("_test", "fixtures")
+	exit15 := filepath.Join(fixDir, "exit15.go")
+
+	Convey("Should label the output of each script", t, func() {
+		var stdout, stderr bytes.Buffer
+		results := RunConcurrent(context.Background(), []ScriptRun{
+			{Label: "a", Scripts: []string{exit15}},
+			{Label: "bb", Scripts: []string{exit15}},
+			{Label: "c", Dir: filepath.Join(fixDir, "exit15_dir")},
+			{Label: "d", Scripts: []string{filepath.Join(fixDir, "synerr.go")}},
+		}, ConcurrentOptions{
+			ScriptOptions: ScriptOptions{
+				Temp:   filepath.Join("_test", "tmp"),
+				Stdout: &stdout, Stderr: &stderr,
+			},
+			Workers: 2,
+		})
+
+		So(len(results), ShouldEqual, 4)
+		So(results[0].Label, ShouldEqual, "a")
+		So(results[0].Status(), ShouldEqual, 15)
+		So(results[1].Status(), ShouldEqual, 15)
+		So(results[2].Status(), ShouldEqual, 15)
+		So(results[3].Err, ShouldNotBeNil)
+		So(results[3].Status(), ShouldEqual, 1)
+		So(RunsStatus(results), ShouldEqual, 15)
+
+		lines := strings.Split(stdout.String(), "\n")
+		So(lines, ShouldContain, "a  | STDOUT: Exiting 15")
+		So(lines, ShouldContain, "bb | STDOUT: Exiting 15")
+		So(stderr.String(), ShouldContainSubstring,
+			"bb | STDERR: Exiting 15\n")
+
+		var summary bytes.Buffer
+		So(WriteRunSummary(&summary, results), ShouldBeNil)
+		So(summary.String(), ShouldStartWith, "a   exit 15")
+		So(summary.String(), ShouldContainSubstring, "d   failed")
+	})
+}
+
+func TestPrefixWriter(t *testing.T) {
+	Convey("Should prefix whole lines", t, func() {
+		var buf bytes.Buffer
+		w := newPrefixWriter(&sync.Mutex{}, &buf, "x | ")
+		w.Write([]byte("foo\nb"))
+		So(buf.String(), ShouldEqual, "x | foo\n")
+		w.Write([]byte("ar\nbaz"))
+		w.Flush()
+		So(buf.String(), ShouldEqual, "x | foo\nx | bar\nx | baz\n")
+	})
+
+	Convey("Should return write errors", t, func() {
+		w := newPrefixWriter(&sync.Mutex{}, errWriter{}, "x | ")
+		_, err := w.Write([]byte("foo\n"))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
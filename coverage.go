@@ -0,0 +1,306 @@
+package goscriptify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FileCoverage is the statement coverage of a single source file.
+type FileCoverage struct {
+	File       string
+	Statements int
+	Covered    int
+}
+
+// Percent returns the percentage of statements covered.
+func (c FileCoverage) Percent() float64 {
+	if c.Statements == 0 {
+		return 0
+	}
+	return float64(c.Covered) / float64(c.Statements) * 100
+}
+
+// ScriptCoverage is the merged coverage of every run of a script.
+type ScriptCoverage struct {
+	// The original paths of the script sources, or the script dir.
+	Scripts []string
+
+	// The GOCOVERDIR the script runs wrote their coverage to.
+	Dir string
+
+	Files []FileCoverage
+}
+
+// Total returns the coverage of all of the script files combined.
+func (c ScriptCoverage) Total() FileCoverage {
+	t := FileCoverage{File: strings.Join(c.Scripts, " ")}
+	for _, f := range c.Files {
+		t.Statements += f.Statements
+		t.Covered += f.Covered
+	}
+	return t
+}
+
+// coverageInfo is stored next to each script coverage dir, describing
+// the script it belongs to.
+type coverageInfo struct {
+	// The go command that built the script, which must also read its
+	// coverage.
+	Go string
+
+	Scripts []string
+
+	// The generated script paths, mapped to their original paths.
+	Files map[string]string
+}
+
+// SummarizeCoverage merges the coverage collected by each script run
+// with ScriptOptions.CoverDir set to coverDir, and summarizes it per
+// script.
+func SummarizeCoverage(coverDir string) ([]ScriptCoverage, error) {
+	infos, err := filepath.Glob(filepath.Join(coverDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var cs []ScriptCoverage
+	for _, p := range infos {
+		dir := strings.TrimSuffix(p, ".json")
+		info, err := readCoverageInfo(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		err = WriteCoverageProfile(dir, &buf)
+		if err != nil {
+			return nil, err
+		}
+
+		files, err := summarizeProfile(&buf)
+		if err != nil {
+			return nil, err
+		}
+
+		cs = append(cs, ScriptCoverage{
+			Scripts: info.Scripts,
+			Dir:     dir,
+			Files:   files,
+		})
+	}
+	return cs, nil
+}
+
+// WriteCoverageProfile merges the coverage of a single script coverage
+// dir, as found in ScriptCoverage.Dir, and writes it to w as a text
+// profile usable by `go tool cover`. Generated script paths within the
+// profile are replaced with their original paths.
+func WriteCoverageProfile(dir string, w io.Writer) error {
+	info, err := readCoverageInfo(dir)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile("", "goscriptify-cover")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	var stderr bytes.Buffer
+	args := []string{"tool", "covdata", "textfmt", "-i=" + dir, "-o=" + f.Name()}
+	err = runGo(context.Background(), "cover", "", args,
+		BuildOptions{Go: info.Go}, nil, &stderr)
+	if err != nil {
+		return fmt.Errorf("Go covdata failed: %s\n\n%s", err, stderr.String())
+	}
+
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+
+	lines := strings.SplitAfter(string(b), "\n")
+	for _, l := range lines {
+		if i := strings.LastIndex(l, ".go:"); i != -1 {
+			if orig, ok := info.Files[l[:i+3]]; ok {
+				l = orig + l[i+3:]
+			}
+		}
+		if _, err := io.WriteString(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summarizeProfile sums the statements of each file of a text coverage
+// profile.
+func summarizeProfile(r io.Reader) ([]FileCoverage, error) {
+	// Blocks may be repeated within a profile, so each block is only
+	// counted once, as covered if any count is non-zero.
+	type block struct{ file, pos string }
+	stmts := map[block]int{}
+	covered := map[block]bool{}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		l := s.Text()
+		if l == "" || strings.HasPrefix(l, "mode:") {
+			continue
+		}
+
+		// Eg: /path/to/file.go:6.2,6.22 1 1
+		fields := strings.Fields(l)
+		i := strings.LastIndex(l, ":")
+		if len(fields) != 3 || i == -1 {
+			return nil, fmt.Errorf("Invalid coverage profile line: %q", l)
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, err
+		}
+
+		b := block{file: l[:i], pos: fields[0][i+1:]}
+		stmts[b] = n
+		covered[b] = covered[b] || count > 0
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	byFile := map[string]*FileCoverage{}
+	for b, n := range stmts {
+		fc, ok := byFile[b.file]
+		if !ok {
+			fc = &FileCoverage{File: b.file}
+			byFile[b.file] = fc
+		}
+		fc.Statements += n
+		if covered[b] {
+			fc.Covered += n
+		}
+	}
+
+	files := make([]FileCoverage, 0, len(byFile))
+	for _, fc := range byFile {
+		files = append(files, *fc)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].File < files[j].File
+	})
+	return files, nil
+}
+
+// prepareCoverage creates the coverage dir for the script with the given
+// bin hash, and describes the script next to it. files maps the script
+// sources, as named in coverage profiles, to their original paths. The
+// environment for the script to write its coverage to the dir is
+// returned.
+//
+// The hash doesn't cover the script sources, so if the bin was rebuilt
+// the coverage of earlier builds is removed. Otherwise their blocks would
+// be counted along with those of the current build.
+func prepareCoverage(coverDir, hash string, tc Toolchain, scripts []string,
+	files map[string]string, rebuilt bool) ([]string, error) {
+	dir, err := filepath.Abs(filepath.Join(coverDir, hash))
+	if err != nil {
+		return nil, err
+	}
+
+	if rebuilt {
+		err = os.RemoveAll(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = os.MkdirAll(dir, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	info := coverageInfo{
+		Go:      tc.Go,
+		Scripts: scripts,
+		Files:   files,
+	}
+
+	b, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ioutil.WriteFile(dir+".json", b, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{"GOCOVERDIR=" + dir}, nil
+}
+
+// scriptCoverageFiles maps the generated script paths, as named in
+// coverage profiles, to their original paths.
+func scriptCoverageFiles(ps []ScriptPath) (map[string]string, error) {
+	files := map[string]string{}
+	for _, s := range ps {
+		gen, err := filepath.Abs(s.Generated)
+		if err != nil {
+			return nil, err
+		}
+		files[gen] = s.Original
+	}
+	return files, nil
+}
+
+// dirCoverageFiles maps the sources of the script dir, as named in
+// coverage profiles, to their paths within the dir. Profiles name the
+// sources of a package by its import path, so it's resolved with go
+// list.
+func dirCoverageFiles(ctx context.Context, dir string, srcs []string,
+	tc Toolchain) (map[string]string, error) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"list", "-f", "{{.ImportPath}}", "."}
+	err := runGo(ctx, "list", dir, args, BuildOptions{Go: tc.Go},
+		&stdout, &stderr)
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("Go list failed: %s\n\n%s", err,
+				stderr.String())
+		}
+		return nil, err
+	}
+	pkg := strings.TrimSpace(stdout.String())
+
+	files := map[string]string{}
+	for _, s := range srcs {
+		files[path.Join(pkg, filepath.Base(s))] = s
+	}
+	return files, nil
+}
+
+func readCoverageInfo(dir string) (coverageInfo, error) {
+	var info coverageInfo
+	b, err := ioutil.ReadFile(filepath.Clean(dir) + ".json")
+	if err != nil {
+		return info, err
+	}
+	return info, json.Unmarshal(b, &info)
+}
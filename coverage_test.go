@@ -0,0 +1,106 @@
+package goscriptify
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSummarizeCoverage(t *testing.T) {
+	src := filepath.Join("_test", "fixtures", "branch")
+	coverDir := filepath.Join("_test", "tmp", "cover")
+	os.RemoveAll(coverDir)
+
+	opts := ScriptOptions{
+		Temp:  filepath.Join("_test", "tmp"),
+		Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+		CoverDir: coverDir,
+	}
+
+	Convey("Should summarize coverage per original script", t, func() {
+		exit, err := RunScriptsWithOpts([]string{src}, []string{}, opts)
+		So(err, ShouldBeNil)
+		So(exit, ShouldEqual, 15)
+
+		cs, err := SummarizeCoverage(coverDir)
+		So(err, ShouldBeNil)
+		So(len(cs), ShouldEqual, 1)
+		So(cs[0].Scripts, ShouldResemble, []string{src})
+		So(len(cs[0].Files), ShouldEqual, 1)
+		So(cs[0].Files[0].File, ShouldEqual, src)
+		So(cs[0].Files[0].Covered, ShouldBeLessThan,
+			cs[0].Files[0].Statements)
+
+		Convey("Should merge the coverage of each run", func() {
+			exit, err := RunScriptsWithOpts([]string{src}, []string{"a"}, opts)
+			So(err, ShouldBeNil)
+			So(exit, ShouldEqual, 1)
+
+			cs, err := SummarizeCoverage(coverDir)
+			So(err, ShouldBeNil)
+			So(cs[0].Total().Percent(), ShouldEqual, 100)
+
+			var profile bytes.Buffer
+			So(WriteCoverageProfile(cs[0].Dir, &profile), ShouldBeNil)
+			So(strings.HasPrefix(profile.String(), "mode:"), ShouldBeTrue)
+			So(profile.String(), ShouldContainSubstring, src+":")
+		})
+	})
+
+	Convey("Should drop the coverage of earlier builds", t, func() {
+		edited := filepath.Join("_test", "tmp", "branch")
+		b, err := ioutil.ReadFile(src)
+		So(err, ShouldBeNil)
+		So(ioutil.WriteFile(edited, b, 0666), ShouldBeNil)
+		os.RemoveAll(coverDir)
+
+		_, err = RunScriptsWithOpts([]string{edited}, []string{}, opts)
+		So(err, ShouldBeNil)
+		cs, err := SummarizeCoverage(coverDir)
+		So(err, ShouldBeNil)
+		before := cs[0].Total().Statements
+
+		// An extra statement, which is run.
+		b = bytes.Replace(b, []byte("func main() {"),
+			[]byte("func main() {\n\tos.Getpid()"), 1)
+		So(ioutil.WriteFile(edited, b, 0666), ShouldBeNil)
+		_, err = RunScriptsWithOpts([]string{edited}, []string{}, opts)
+		So(err, ShouldBeNil)
+
+		cs, err = SummarizeCoverage(coverDir)
+		So(err, ShouldBeNil)
+		So(len(cs), ShouldEqual, 1)
+		So(cs[0].Total().Statements, ShouldEqual, before+1)
+	})
+}
+
+func TestSummarizeDirCoverage(t *testing.T) {
+	dir := filepath.Join("_test", "fixtures", "exit15_dir")
+	coverDir := filepath.Join("_test", "tmp", "cover_dir")
+	os.RemoveAll(coverDir)
+
+	opts := ScriptOptions{
+		Temp:  filepath.Join("_test", "tmp"),
+		Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+		CoverDir: coverDir,
+	}
+
+	Convey("Should summarize coverage per original dir file", t, func() {
+		exit, err := RunScriptDirWithOpts(dir, []string{}, opts)
+		So(err, ShouldBeNil)
+		So(exit, ShouldEqual, 15)
+
+		cs, err := SummarizeCoverage(coverDir)
+		So(err, ShouldBeNil)
+		So(len(cs), ShouldEqual, 1)
+		So(cs[0].Scripts, ShouldResemble, []string{dir})
+		So(len(cs[0].Files), ShouldEqual, 1)
+		So(cs[0].Files[0].File, ShouldEqual, filepath.Join(dir, "exit15.go"))
+		So(cs[0].Total().Percent(), ShouldEqual, 100)
+	})
+}
@@ -0,0 +1,687 @@
+package goscriptify
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The frame types of the daemon protocol.
+const (
+	frameRun    byte = 'R'
+	frameStdin  byte = 'I'
+	frameSignal byte = 'S'
+	frameStdout byte = 'O'
+	frameStderr byte = 'E'
+	frameExit   byte = 'X'
+)
+
+// maxFrame is the largest frame payload accepted.
+const maxFrame = 16 << 20
+
+// DaemonRequest asks a Daemon to run a script.
+type DaemonRequest struct {
+	// Scripts, or the go package Dir, to run. Relative paths are relative
+	// to Cwd.
+	Scripts []string
+	Dir     string
+
+	Args []string
+
+	// Env is the entire environment of the script, and Cwd its working
+	// directory.
+	Env []string
+	Cwd string
+}
+
+// DaemonExit is how a script run by a Daemon exited.
+type DaemonExit struct {
+	// Result is how the script exited, unless it failed to build or
+	// run.
+	Result *RunResult
+
+	// BuildError is set if the script failed to build, and Error for any
+	// other failure.
+	BuildError *BuildError
+	Error      string
+}
+
+// Daemon keeps scripts compiled, recompiling them as their sources
+// change, and runs them for clients. See ListenDaemon and RunDaemon.
+//
+// Any client able to connect can run any script as the daemon's user, so
+// the socket of ListenDaemon is only accessible to that user.
+//
+// Clients run scripts with the daemon protocol, one run per connection.
+// Each message is a frame of a one byte type, a four byte big endian
+// payload length, and the payload:
+//
+//	+------+----------------+-----------------+
+//	| type | length (uint32) | payload         |
+//	+------+----------------+-----------------+
+//
+// The client first sends a run frame, 'R', with a JSON DaemonRequest.
+// While the script runs the client may send:
+//
+//	'I'  stdin data for the script. An empty payload closes its stdin.
+//	     If the script falls 16MB behind in reading its stdin, the rest
+//	     is dropped and its stdin closed.
+//	'S'  a signal for the script, as a four byte big endian number.
+//
+// The daemon sends:
+//
+//	'O'  stdout data from the script.
+//	'E'  stderr data from the script.
+//	'X'  the JSON DaemonExit, once the script has exited and all of its
+//	     output has been sent. The daemon then closes the connection.
+//
+// If the client disconnects, the script is stopped as if cancelled.
+type Daemon struct {
+	opts ScriptOptions
+
+	mu      sync.Mutex
+	entries map[string]*daemonEntry
+}
+
+// daemonEntry is a script kept compiled by a Daemon.
+type daemonEntry struct {
+	scripts []string
+	dir     string
+
+	mu    sync.Mutex
+	c     *compiled
+	state sourceState
+	err   error
+}
+
+// NewDaemon returns a Daemon which builds and runs scripts with the given
+// options. The stdio, Env and Dir of opts are replaced by those of each
+// client.
+func NewDaemon(opts ScriptOptions) *Daemon {
+	return &Daemon{opts: opts, entries: map[string]*daemonEntry{}}
+}
+
+// Register has the daemon keep the given scripts compiled. Scripts are
+// also registered when first run by a client.
+func (d *Daemon) Register(scripts []string) error {
+	abs, err := absPaths(scripts)
+	if err != nil {
+		return err
+	}
+	_, err = d.entry(abs, "").compiled(context.Background(), d.opts)
+	return err
+}
+
+// RegisterDir has the daemon keep the given go package dir compiled.
+func (d *Daemon) RegisterDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	_, err = d.entry(nil, abs).compiled(context.Background(), d.opts)
+	return err
+}
+
+// entry returns the registered entry of the absolute scripts or dir,
+// registering it if needed.
+func (d *Daemon) entry(scripts []string, dir string) *daemonEntry {
+	key := dir
+	if dir == "" {
+		key = strings.Join(scripts, string(filepath.ListSeparator))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.entries[key]
+	if !ok {
+		e = &daemonEntry{scripts: scripts, dir: dir}
+		d.entries[key] = e
+	}
+	return e
+}
+
+// sources returns the state of the entry's sources.
+func (e *daemonEntry) sources() sourceState {
+	if e.dir == "" {
+		return statSources(e.scripts)
+	}
+	ps, _ := dirFiles(e.dir)
+	return statSources(ps)
+}
+
+// compiled returns the compiled script, compiling it first if its
+// sources have changed since it was last compiled.
+func (e *daemonEntry) compiled(ctx context.Context,
+	opts ScriptOptions) (*compiled, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// The state is taken before compiling, so that changes made while
+	// compiling are seen next time.
+	start := time.Now()
+	state := e.sources()
+	if e.state != nil && state.equal(e.state) {
+		if e.err != nil {
+			return nil, e.err
+		}
+		// Reusing the compiled script is a cached build.
+		c := *e.c
+		c.Cached, c.BuildTime = true, time.Since(start)
+		return &c, nil
+	}
+
+	if e.dir != "" {
+		e.c, e.err = compileDir(ctx, e.dir, opts, compileExec)
+	} else {
+		e.c, e.err = compileScripts(ctx, e.scripts, opts, compileExec)
+	}
+	e.state = state
+	if e.err != nil && ctx.Err() != nil {
+		// A cancelled compile is retried, rather than remembered.
+		e.state = nil
+	}
+	return e.c, e.err
+}
+
+// ListenDaemon serves the daemon on the Unix socket at path, until ctx
+// is done. Any stale socket left at path is replaced. The socket is only
+// accessible to our user, with mode 0600.
+func (d *Daemon) ListenDaemon(ctx context.Context, path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	l, err := listenPrivate(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	return d.Serve(ctx, l)
+}
+
+// listenPrivate listens on a Unix socket at path, with mode 0600. The
+// socket is created within a private dir and then moved to path, so
+// that it's never accessible to other users.
+func listenPrivate(path string) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".gos")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	tmp := filepath.Join(dir, "s")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// The socket is moved, so it's removed by ListenDaemon instead.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	err = os.Chmod(tmp, 0600)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve serves the daemon on the listener, until ctx is done. While
+// serving, registered scripts are recompiled as their sources change,
+// checked every opts.WatchInterval.
+func (d *Daemon) Serve(ctx context.Context, l net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	go d.precompile(ctx)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.serveConn(ctx, conn)
+		}()
+	}
+}
+
+// precompile recompiles registered scripts as their sources change,
+// until ctx is done.
+func (d *Daemon) precompile(ctx context.Context) {
+	interval := d.opts.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		d.mu.Lock()
+		entries := make([]*daemonEntry, 0, len(d.entries))
+		for _, e := range d.entries {
+			entries = append(entries, e)
+		}
+		d.mu.Unlock()
+
+		// Build errors are reported to the clients that run the script.
+		for _, e := range entries {
+			e.compiled(ctx, d.opts)
+		}
+	}
+}
+
+// serveConn runs the script requested by the connection.
+func (d *Daemon) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	fc := &frameConn{rw: conn}
+
+	typ, payload, err := fc.read()
+	if err != nil || typ != frameRun {
+		return
+	}
+	var req DaemonRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		fc.writeExit(nil, err)
+		return
+	}
+
+	// The run is stopped if the client disconnects.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	res, err := d.run(ctx, fc, req, cancel)
+	fc.writeExit(res, err)
+}
+
+// run compiles, if needed, and runs the requested script, relaying its
+// stdio over fc.
+func (d *Daemon) run(ctx context.Context, fc *frameConn, req DaemonRequest,
+	cancel context.CancelFunc) (*RunResult, error) {
+	resolve := func(p string) string {
+		if filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(req.Cwd, p)
+	}
+
+	var e *daemonEntry
+	if req.Dir != "" {
+		e = d.entry(nil, resolve(req.Dir))
+	} else {
+		scripts := make([]string, len(req.Scripts))
+		for i, s := range req.Scripts {
+			scripts[i] = resolve(s)
+		}
+		e = d.entry(scripts, "")
+	}
+
+	opts := d.opts
+	opts.Stdin = nil
+	opts.Stdout = &frameWriter{fc: fc, typ: frameStdout}
+	opts.Stderr = &frameWriter{fc: fc, typ: frameStderr}
+	opts.Env, opts.ReplaceEnv, opts.EnvAllowlist = req.Env, true, nil
+	opts.Dir = req.Cwd
+	opts.ForwardSignals = false
+
+	ctx, stop := withTimeout(ctx, opts.Timeout)
+	c, err := e.compiled(ctx, opts)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+
+	proc, err := startProcess(ctx, stop, c, req.Args, opts, true)
+	if err != nil {
+		return nil, err
+	}
+
+	go relayInput(fc, proc, cancel)
+	return proc.Wait()
+}
+
+// relayInput relays the stdin and signal frames of the client to the
+// process. If the client disconnects, cancel is called.
+//
+// Stdin is written by a stdinQueue, so that a script which isn't reading
+// its stdin cannot keep us from reading its signals, or seeing the
+// client disconnect.
+func relayInput(fc *frameConn, proc *Process, cancel context.CancelFunc) {
+	stdin := newStdinQueue(proc.Stdin)
+	defer stdin.close()
+	for {
+		typ, payload, err := fc.read()
+		if err != nil {
+			cancel()
+			return
+		}
+
+		switch typ {
+		case frameStdin:
+			if len(payload) == 0 {
+				stdin.close()
+				continue
+			}
+			if stdin.push(payload) {
+				fc.write(frameStderr, []byte("goscriptify: the script is "+
+					"not reading its stdin, the rest is dropped\n"))
+			}
+		case frameSignal:
+			if len(payload) == 4 {
+				sig := syscall.Signal(binary.BigEndian.Uint32(payload))
+				proc.Signal(sig)
+			}
+		}
+	}
+}
+
+// maxStdinQueue is the most stdin data queued for a script. Once a
+// script falls this far behind, the rest of its stdin is dropped.
+const maxStdinQueue = maxFrame
+
+// stdinQueue writes stdin data to a script in the background, closing
+// the script's stdin once it's closed and drained.
+type stdinQueue struct {
+	w io.WriteCloser
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	bufs   [][]byte
+	size   int
+	closed bool
+}
+
+func newStdinQueue(w io.WriteCloser) *stdinQueue {
+	q := &stdinQueue{w: w}
+	q.cond = sync.NewCond(&q.mu)
+	go q.run()
+	return q
+}
+
+// push queues b to be written. It returns true if b, and the rest of the
+// stdin, is dropped for overflowing the queue, only the first time.
+func (q *stdinQueue) push(b []byte) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	if q.size+len(b) > maxStdinQueue {
+		q.closed = true
+		q.cond.Signal()
+		return true
+	}
+	q.bufs = append(q.bufs, b)
+	q.size += len(b)
+	q.cond.Signal()
+	return false
+}
+
+// close closes the queue, once the data already queued is written.
+func (q *stdinQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Signal()
+}
+
+// run writes the queued data until the queue is closed and drained, or a
+// write fails.
+func (q *stdinQueue) run() {
+	defer q.w.Close()
+	for {
+		q.mu.Lock()
+		for len(q.bufs) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.bufs) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		b := q.bufs[0]
+		q.bufs = q.bufs[1:]
+		q.mu.Unlock()
+
+		_, err := q.w.Write(b)
+
+		q.mu.Lock()
+		q.size -= len(b)
+		if err != nil {
+			// The script is no longer reading, so the rest is discarded.
+			q.bufs, q.size, q.closed = nil, 0, true
+		}
+		q.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// RunDaemon runs the scripts, or the go package dir if non-empty, with
+// the Daemon listening on the Unix socket at path. The stdio, Env,
+// ReplaceEnv and Dir of opts are given to the script, and the rest are
+// ignored in favor of the options of the Daemon.
+//
+// If ctx is done before the script exits, the script is stopped by
+// disconnecting from the daemon.
+func RunDaemon(ctx context.Context, path string, scripts []string,
+	dir string, args []string, opts ScriptOptions) (*RunResult, error) {
+	req := DaemonRequest{Args: args, Cwd: opts.Dir}
+	if req.Cwd == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		req.Cwd = wd
+	}
+	if !opts.ReplaceEnv {
+		req.Env = os.Environ()
+	}
+	req.Env = dedupEnv(append(req.Env, opts.Env...))
+
+	if dir != "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		req.Dir = abs
+	} else {
+		abs, err := absPaths(scripts)
+		if err != nil {
+			return nil, err
+		}
+		req.Scripts = abs
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Disconnecting stops the script.
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	fc := &frameConn{rw: conn}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := fc.write(frameRun, b); err != nil {
+		return nil, err
+	}
+
+	if opts.Stdin != nil {
+		go func() {
+			io.Copy(&frameWriter{fc: fc, typ: frameStdin}, opts.Stdin)
+			fc.write(frameStdin, nil)
+		}()
+	} else {
+		fc.write(frameStdin, nil)
+	}
+
+	if opts.ForwardSignals {
+		stopSignals := forwardDaemonSignals(fc)
+		defer stopSignals()
+	}
+
+	for {
+		typ, payload, err := fc.read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctxError(ctx, "run")
+			}
+			return nil, err
+		}
+
+		switch typ {
+		case frameStdout:
+			if opts.Stdout != nil {
+				opts.Stdout.Write(payload)
+			}
+		case frameStderr:
+			if opts.Stderr != nil {
+				opts.Stderr.Write(payload)
+			}
+		case frameExit:
+			var exit DaemonExit
+			if err := json.Unmarshal(payload, &exit); err != nil {
+				return nil, err
+			}
+			switch {
+			case exit.BuildError != nil:
+				return nil, exit.BuildError
+			case exit.Error != "":
+				return nil, errors.New(exit.Error)
+			}
+			return exit.Result, nil
+		}
+	}
+}
+
+// absPaths returns the absolute form of each path.
+func absPaths(ps []string) ([]string, error) {
+	abs := make([]string, len(ps))
+	for i, p := range ps {
+		a, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		abs[i] = a
+	}
+	return abs, nil
+}
+
+// frameConn reads and writes frames of the daemon protocol. Writes may
+// be made concurrently.
+type frameConn struct {
+	rw io.ReadWriter
+	mu sync.Mutex
+}
+
+// read reads the next frame.
+func (c *frameConn) read() (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(c.rw, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > maxFrame {
+		return 0, nil, fmt.Errorf("goscriptify: daemon frame of %d bytes "+
+			"exceeds the limit", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0], payload, nil
+}
+
+// write writes a frame.
+func (c *frameConn) write(typ byte, payload []byte) error {
+	b := make([]byte, 5+len(payload))
+	b[0] = typ
+	binary.BigEndian.PutUint32(b[1:], uint32(len(payload)))
+	copy(b[5:], payload)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.rw.Write(b)
+	return err
+}
+
+// writeExit writes the exit frame for the result and error of a run.
+func (c *frameConn) writeExit(res *RunResult, err error) error {
+	exit := DaemonExit{Result: res}
+	if builderr, ok := err.(*BuildError); ok {
+		exit.BuildError = builderr
+	} else if err != nil {
+		exit.Error = err.Error()
+	}
+
+	b, err := json.Marshal(exit)
+	if err != nil {
+		return err
+	}
+	return c.write(frameExit, b)
+}
+
+// frameWriter writes data as frames of a type, split to fit maxFrame.
+type frameWriter struct {
+	fc  *frameConn
+	typ byte
+}
+
+func (w *frameWriter) Write(b []byte) (int, error) {
+	for written := 0; written < len(b); {
+		n := len(b) - written
+		if n > maxFrame {
+			n = maxFrame
+		}
+		if err := w.fc.write(w.typ, b[written:written+n]); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return len(b), nil
+}
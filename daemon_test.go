@@ -0,0 +1,147 @@
+package goscriptify
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// startTestDaemon serves a daemon for the tests with the given scripts
+// registered, returning its socket and the func to stop it.
+func startTestDaemon(tb testing.TB, scripts ...string) (sock string,
+	stop func()) {
+	// Unix socket paths are limited in length, so a short temp dir is
+	// used.
+	sockDir, err := ioutil.TempDir("", "gos")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	sock = filepath.Join(sockDir, "daemon.sock")
+
+	d := NewDaemon(ScriptOptions{
+		Temp:          filepath.Join("_test", "tmp"),
+		Stderr:        ioutil.Discard,
+		WatchInterval: 20 * time.Millisecond,
+	})
+	for _, s := range scripts {
+		if err := d.Register([]string{s}); err != nil {
+			os.RemoveAll(sockDir)
+			tb.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- d.ListenDaemon(ctx, sock)
+	}()
+
+	// Wait for the daemon to listen.
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(sock); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return sock, func() {
+		cancel()
+		<-served
+		os.RemoveAll(sockDir)
+	}
+}
+
+func TestDaemon(t *testing.T) {
+	fixDir := filepath.Join("_test", "fixtures")
+	sock, stop := startTestDaemon(t, filepath.Join(fixDir, "exit15.go"))
+	defer stop()
+	sockDir := filepath.Dir(sock)
+
+	Convey("Should only allow our user to connect", t, func() {
+		fi, err := os.Stat(sock)
+		So(err, ShouldBeNil)
+		So(fi.Mode()&os.ModeSocket, ShouldNotEqual, 0)
+		So(fi.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+
+		// The private dir the socket was created in is removed.
+		entries, err := ioutil.ReadDir(sockDir)
+		So(err, ShouldBeNil)
+		So(len(entries), ShouldEqual, 1)
+	})
+
+	Convey("Should run a registered script", t, func() {
+		var stdout, stderr bytes.Buffer
+		res, err := RunDaemon(context.Background(), sock,
+			[]string{filepath.Join(fixDir, "exit15.go")}, "", []string{},
+			ScriptOptions{Stdout: &stdout, Stderr: &stderr})
+		So(err, ShouldBeNil)
+		So(res.ExitCode, ShouldEqual, 15)
+		So(res.Cached, ShouldBeTrue)
+		So(stdout.String(), ShouldEqual, "STDOUT: Exiting 15")
+		So(stderr.String(), ShouldEqual, "STDERR: Exiting 15")
+	})
+
+	Convey("Should forward stdin", t, func() {
+		var stdout bytes.Buffer
+		res, err := RunDaemon(context.Background(), sock,
+			[]string{filepath.Join(fixDir, "echostdin.go")}, "", []string{},
+			ScriptOptions{Stdin: strings.NewReader("foo bar"), Stdout: &stdout})
+		So(err, ShouldBeNil)
+		So(res.ExitCode, ShouldEqual, 3)
+		So(stdout.String(), ShouldEqual, "foo bar")
+	})
+
+	Convey("Should forward the env, args and working directory", t, func() {
+		var stdout bytes.Buffer
+		res, err := RunDaemon(context.Background(), sock,
+			[]string{filepath.Join(fixDir, "env.go")}, "",
+			[]string{"GOSCRIPTIFY_TEST_D"}, ScriptOptions{
+				Stdout: &stdout,
+				Env:    []string{"GOSCRIPTIFY_TEST_D=d"},
+				Dir:    fixDir,
+			})
+		So(err, ShouldBeNil)
+		So(res.ExitCode, ShouldEqual, 0)
+		So(stdout.String(), ShouldEqual, "fixtures\nGOSCRIPTIFY_TEST_D=d true\n")
+	})
+
+	Convey("Should return build errors", t, func() {
+		_, err := RunDaemon(context.Background(), sock,
+			[]string{filepath.Join(fixDir, "synerr.go")}, "", []string{},
+			ScriptOptions{})
+		_, ok := err.(*BuildError)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Should run a script dir", t, func() {
+		res, err := RunDaemon(context.Background(), sock, nil,
+			filepath.Join(fixDir, "exit15_dir"), []string{}, ScriptOptions{})
+		So(err, ShouldBeNil)
+		So(res.ExitCode, ShouldEqual, 15)
+	})
+}
+
+func BenchmarkRunDaemon(b *testing.B) {
+	exit15 := filepath.Join("_test", "fixtures", "exit15.go")
+	sock, stop := startTestDaemon(b, exit15)
+	defer stop()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res, err := RunDaemon(context.Background(), sock, []string{exit15},
+			"", []string{}, ScriptOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if res.ExitCode != 15 {
+			b.Fatalf("exit code %d", res.ExitCode)
+		}
+	}
+}
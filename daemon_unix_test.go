@@ -0,0 +1,109 @@
+//go:build !windows
+// +build !windows
+
+package goscriptify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// dialTestRun starts a run of the script on the daemon, returning its
+// connection once the script has written a line to its stdout.
+func dialTestRun(sock, script string) (*frameConn, net.Conn, string) {
+	conn, err := net.Dial("unix", sock)
+	So(err, ShouldBeNil)
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	abs, err := filepath.Abs(script)
+	So(err, ShouldBeNil)
+	b, err := json.Marshal(DaemonRequest{Scripts: []string{abs}, Cwd: "."})
+	So(err, ShouldBeNil)
+	fc := &frameConn{rw: conn}
+	So(fc.write(frameRun, b), ShouldBeNil)
+
+	var stdout bytes.Buffer
+	for !strings.Contains(stdout.String(), "\n") {
+		typ, payload, err := fc.read()
+		So(err, ShouldBeNil)
+		So(typ, ShouldNotEqual, frameExit)
+		if typ == frameStdout {
+			stdout.Write(payload)
+		}
+	}
+	return fc, conn, stdout.String()
+}
+
+// readTestExit reads the frames of a run until its exit.
+func readTestExit(fc *frameConn) DaemonExit {
+	for {
+		typ, payload, err := fc.read()
+		So(err, ShouldBeNil)
+		if typ == frameExit {
+			var exit DaemonExit
+			So(json.Unmarshal(payload, &exit), ShouldBeNil)
+			return exit
+		}
+	}
+}
+
+func signalFrame(sig syscall.Signal) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(sig))
+	return b[:]
+}
+
+func TestDaemonSignals(t *testing.T) {
+	waitSignal := filepath.Join("_test", "fixtures", "waitsignal.go")
+	sock, stop := startTestDaemon(t, waitSignal)
+	defer stop()
+
+	Convey("Should forward signals to the script", t, func() {
+		fc, conn, _ := dialTestRun(sock, waitSignal)
+		defer conn.Close()
+
+		So(fc.write(frameSignal, signalFrame(syscall.SIGUSR1)), ShouldBeNil)
+		exit := readTestExit(fc)
+		So(exit.Error, ShouldEqual, "")
+		So(exit.Result.ExitCode, ShouldEqual, 4)
+	})
+
+	Convey("Should forward signals while stdin is unread", t, func() {
+		fc, conn, _ := dialTestRun(sock, waitSignal)
+		defer conn.Close()
+
+		// Far more than a pipe holds, which the script never reads.
+		chunk := make([]byte, 64<<10)
+		for i := 0; i < 32; i++ {
+			So(fc.write(frameStdin, chunk), ShouldBeNil)
+		}
+		So(fc.write(frameSignal, signalFrame(syscall.SIGUSR1)), ShouldBeNil)
+		exit := readTestExit(fc)
+		So(exit.Result.ExitCode, ShouldEqual, 4)
+	})
+
+	Convey("Should stop the script when the client disconnects", t, func() {
+		_, conn, out := dialTestRun(sock, waitSignal)
+		var pid int
+		_, err := fmt.Sscanf(out, "ready %d", &pid)
+		So(err, ShouldBeNil)
+
+		conn.Close()
+		stopped := false
+		for i := 0; i < 500 && !stopped; i++ {
+			stopped = syscall.Kill(pid, 0) == syscall.ESRCH
+			time.Sleep(10 * time.Millisecond)
+		}
+		So(stopped, ShouldBeTrue)
+	})
+}
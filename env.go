@@ -0,0 +1,122 @@
+package goscriptify
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/leeola/goscriptify/scriptinfo"
+)
+
+// environ returns the environment the compiled script is run with. The
+// inherited environment, limited to opts.EnvAllowlist if set, is
+// followed by opts.Env, the location of the script and then c.Env.
+// Later entries replace earlier entries of the same key.
+func (o ScriptOptions) environ(c *compiled) ([]string, error) {
+	var env []string
+	if !o.ReplaceEnv {
+		env = os.Environ()
+	}
+	if o.EnvAllowlist != nil {
+		env = allowEnv(env, o.EnvAllowlist)
+	}
+
+	loc, err := locationEnv(c)
+	if err != nil {
+		return nil, err
+	}
+
+	env = append(env, o.Env...)
+	env = append(env, loc...)
+	env = append(env, c.Env...)
+	return dedupEnv(env), nil
+}
+
+// locationEnv returns the environment variables that describe the
+// compiled script to itself, as read by the scriptinfo package.
+func locationEnv(c *compiled) ([]string, error) {
+	script, err := filepath.Abs(c.Script)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(c.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// A script run by a script is one deeper than its parent.
+	depth, _ := strconv.Atoi(os.Getenv(scriptinfo.EnvDepth))
+
+	return []string{
+		scriptinfo.EnvScript + "=" + script,
+		scriptinfo.EnvScriptDir + "=" + dir,
+		scriptinfo.EnvVersion + "=" + Version,
+		scriptinfo.EnvDepth + "=" + strconv.Itoa(depth+1),
+	}, nil
+}
+
+// workDir returns the directory a script is run in, given the script's
+// own directory. An empty dir runs the script in our working directory.
+func (o ScriptOptions) workDir(scriptDir string) (string, error) {
+	dir := o.Dir
+	if o.InScriptDir {
+		dir = scriptDir
+	}
+	if dir == "" {
+		return "", nil
+	}
+	return filepath.Abs(dir)
+}
+
+// allowEnv returns the entries of env whose keys are in keys.
+func allowEnv(env, keys []string) []string {
+	allowed := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		allowed[envKey(k)] = true
+	}
+
+	var kept []string
+	for _, kv := range env {
+		if allowed[envKey(kv)] {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
+}
+
+// dedupEnv removes entries of env which are replaced by a later entry of
+// the same key, keeping the order of the remaining entries.
+func dedupEnv(env []string) []string {
+	last := make(map[string]int, len(env))
+	for i, kv := range env {
+		last[envKey(kv)] = i
+	}
+
+	deduped := make([]string, 0, len(last))
+	for i, kv := range env {
+		if last[envKey(kv)] == i {
+			deduped = append(deduped, kv)
+		}
+	}
+	return deduped
+}
+
+// envKey returns the key of a KEY=VALUE environment entry. Keys are case
+// insensitive on Windows.
+func envKey(kv string) string {
+	// The first byte is skipped, as hidden Windows entries such as
+	// "=C:=C:\" begin with "=".
+	k := kv
+	if len(kv) > 1 {
+		if i := strings.Index(kv[1:], "="); i >= 0 {
+			k = kv[:i+1]
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		k = strings.ToUpper(k)
+	}
+	return k
+}
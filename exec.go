@@ -0,0 +1,135 @@
+package goscriptify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// DefaultGracePeriod is how long a cancelled process is given to exit
+// after being asked to terminate, before it is killed.
+const DefaultGracePeriod = 5 * time.Second
+
+// TimeoutError is returned when a build or run is stopped because its
+// context deadline, or ScriptOptions.Timeout, was exceeded.
+type TimeoutError struct {
+	// The operation that timed out, eg "build" or "run".
+	Op string
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("goscriptify: %s timed out", e.Op)
+}
+
+// groupKey is the context key recording whether cmds started with the
+// context get their own process group. See newGroup.
+type groupKey struct{}
+
+// withTimeout returns a child context of ctx limited to d, if d is
+// non-zero.
+//
+// The child can always be cancelled, so whether cmds started with it
+// get their own process group is decided by ctx and d, before wrapping.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context,
+	context.CancelFunc) {
+	group := newGroup(ctx) || d > 0
+
+	var cancel context.CancelFunc
+	if d <= 0 {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, d)
+	}
+	return context.WithValue(ctx, groupKey{}, group), cancel
+}
+
+// withoutGroup returns a child context of ctx whose cmds are left in our
+// process group, even though it may be cancelled.
+func withoutGroup(ctx context.Context) context.Context {
+	return context.WithValue(ctx, groupKey{}, false)
+}
+
+// newGroup returns whether cmds started with ctx get their own process
+// group. That's only the case when ctx can be cancelled, or has been
+// given a timeout, by the caller.
+func newGroup(ctx context.Context) bool {
+	if group, ok := ctx.Value(groupKey{}).(bool); ok {
+		return group
+	}
+	return ctx.Done() != nil
+}
+
+// ctxError converts the error of a done context into the error returned
+// to the user. Deadlines become a TimeoutError for the given op, so that
+// they can be told apart from explicit cancellation.
+func ctxError(ctx context.Context, op string) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return &TimeoutError{Op: op}
+	}
+	return ctx.Err()
+}
+
+// startCmd starts the given cmd. If group is true, the cmd is started
+// in its own process group so that the entire group can be stopped
+// together, including any children it spawns. See newGroup.
+//
+// Otherwise the cmd is left in our process group, so that an interactive
+// script still receives terminal input and signals.
+//
+// If ctx is already done, the ctx error is returned.
+func startCmd(ctx context.Context, cmd *exec.Cmd, group bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if group {
+		setProcessGroup(cmd)
+	}
+	return cmd.Start()
+}
+
+// waitCmd waits for the started cmd to exit. If ctx is done first the
+// cmd is asked to terminate, and then killed if it has not exited
+// within grace.
+//
+// Once the cmd has exited, its output is drained for up to grace. A
+// child it left running in the background may hold the cmd's stdout or
+// stderr open, and is not waited for past that.
+//
+// If ctx ended the cmd, the ctx error is returned.
+func waitCmd(ctx context.Context, cmd *exec.Cmd, grace time.Duration) error {
+	if grace <= 0 {
+		grace = DefaultGracePeriod
+	}
+	cmd.WaitDelay = grace
+
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		if errors.Is(err, exec.ErrWaitDelay) {
+			// The cmd itself exited successfully.
+			err = nil
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	terminateCmd(cmd)
+	t := time.NewTimer(grace)
+	defer t.Stop()
+
+	select {
+	case <-done:
+	case <-t.C:
+		killCmd(cmd)
+		<-done
+	}
+
+	return ctx.Err()
+}
@@ -0,0 +1,128 @@
+//go:build !windows
+// +build !windows
+
+package goscriptify
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// forwardedSignals are the catchable signals forwarded to scripts when
+// ScriptOptions.ForwardSignals is set. Job control signals are left
+// alone, so that the terminal can still stop and continue us.
+var forwardedSignals = []os.Signal{
+	syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM,
+	syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGALRM, syscall.SIGWINCH,
+}
+
+// terminalSignals are sent by the terminal to its entire foreground
+// process group. A script sharing our process group already receives
+// them, so they're not forwarded to it.
+var terminalSignals = map[os.Signal]bool{
+	syscall.SIGINT: true, syscall.SIGQUIT: true, syscall.SIGWINCH: true,
+}
+
+// setProcessGroup makes the cmd the leader of a new process group. A cmd
+// starting a new session already leads its own process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if !cmd.SysProcAttr.Setsid {
+		cmd.SysProcAttr.Setpgid = true
+	}
+}
+
+// leadsGroup returns whether the cmd leads its own process group.
+func leadsGroup(cmd *exec.Cmd) bool {
+	attr := cmd.SysProcAttr
+	return attr != nil && (attr.Setpgid || attr.Setsid)
+}
+
+// signalCmd sends sig to the cmd, or to its entire process group if it
+// leads one.
+func signalCmd(cmd *exec.Cmd, sig syscall.Signal) error {
+	pid := cmd.Process.Pid
+	if leadsGroup(cmd) {
+		pid = -pid
+	}
+	return syscall.Kill(pid, sig)
+}
+
+// terminateCmd asks the cmd to exit with SIGTERM.
+func terminateCmd(cmd *exec.Cmd) error {
+	return signalCmd(cmd, syscall.SIGTERM)
+}
+
+// killCmd forcefully stops the cmd with SIGKILL.
+func killCmd(cmd *exec.Cmd) error {
+	return signalCmd(cmd, syscall.SIGKILL)
+}
+
+// forwardSignals relays the forwardedSignals received by this process
+// to the started cmd, until the returned func is called. While relaying,
+// the signals no longer terminate this process, allowing it to wait for
+// the cmd to exit.
+func forwardSignals(cmd *exec.Cmd) (stop func()) {
+	ownGroup := leadsGroup(cmd)
+
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, forwardedSignals...)
+
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				if ownGroup || !terminalSignals[sig] {
+					cmd.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// forwardDaemonSignals relays the forwardedSignals received by this
+// process to the script run by the daemon connection, until the returned
+// func is called. As the script is not in our process group, terminal
+// signals are forwarded too.
+func forwardDaemonSignals(fc *frameConn) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, forwardedSignals...)
+
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				var b [4]byte
+				binary.BigEndian.PutUint32(b[:], uint32(sig.(syscall.Signal)))
+				fc.write(frameSignal, b[:])
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// execBin replaces this process with the bin at p, given the args and
+// env. It only returns if the exec fails.
+func execBin(p string, args, env []string) error {
+	return syscall.Exec(p, append([]string{p}, args...), env)
+}
@@ -0,0 +1,128 @@
+//go:build !windows
+// +build !windows
+
+package goscriptify
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestForwardSignals(t *testing.T) {
+	e := filepath.Join("_test", "fixtures", "trapusr1.bash")
+
+	Convey("Should forward signals to the script", t, func() {
+		// Ensure SIGUSR1 can never terminate the test itself.
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGUSR1)
+		defer signal.Stop(sigs)
+
+		// Signal ourselves once the script is ready.
+		r, w := io.Pipe()
+		go func() {
+			b := make([]byte, 5)
+			io.ReadFull(r, b)
+			syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+			io.Copy(ioutil.Discard, r)
+		}()
+
+		res, err := RunExecContext(context.Background(), e, []string{},
+			ScriptOptions{
+				Stdout: w, Stderr: ioutil.Discard,
+				ForwardSignals: true,
+			})
+		w.Close()
+		So(err, ShouldBeNil)
+		So(res.ExitCode, ShouldEqual, 10)
+	})
+}
+
+func TestExecScript(t *testing.T) {
+	src := filepath.Join("_test", "fixtures", "exit15.go")
+
+	// When re-run by the test below, replace the test process with the
+	// script.
+	if os.Getenv("GOSCRIPTIFY_TEST_EXEC") == "1" {
+		err := ExecScriptsContext(context.Background(), []string{src},
+			[]string{}, ScriptOptions{Temp: filepath.Join("_test", "tmp")})
+		t.Fatal(err)
+	}
+
+	Convey("Should replace the process with the script", t, func() {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestExecScript$")
+		cmd.Env = append(os.Environ(), "GOSCRIPTIFY_TEST_EXEC=1")
+		var stdout bytes.Buffer
+		cmd.Stdout = &stdout
+		err := cmd.Run()
+
+		exitErr, ok := err.(*exec.ExitError)
+		So(ok, ShouldBeTrue)
+		So(exitErr.ExitCode(), ShouldEqual, 15)
+		So(stdout.String(), ShouldEqual, "STDOUT: Exiting 15")
+	})
+}
+
+func TestProcessGroup(t *testing.T) {
+	e := filepath.Join("_test", "fixtures", "pgid.bash")
+	pgid := strconv.Itoa(syscall.Getpgrp())
+
+	Convey("Should leave scripts in our process group", t, func() {
+		var stdout bytes.Buffer
+		code, err := RunExec(e, []string{}, nil, &stdout, ioutil.Discard)
+		So(err, ShouldBeNil)
+		So(code, ShouldEqual, 0)
+		So(strings.TrimSpace(stdout.String()), ShouldEqual, pgid)
+	})
+
+	Convey("Should give scripts their own group if cancellable", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var stdout bytes.Buffer
+		res, err := RunExecContext(ctx, e, []string{}, ScriptOptions{
+			Stdout: &stdout, Stderr: ioutil.Discard,
+		})
+		So(err, ShouldBeNil)
+		So(res.ExitCode, ShouldEqual, 0)
+		So(strings.TrimSpace(stdout.String()), ShouldNotEqual, pgid)
+	})
+}
+
+func TestRunScriptSignalWhileBuilding(t *testing.T) {
+	src := filepath.Join("_test", "fixtures", "exit0.go")
+
+	// When re-run by the test below, run the script as a wrapper.
+	if os.Getenv("GOSCRIPTIFY_TEST_WRAPPER") == "1" {
+		RunScript(src)
+	}
+
+	Convey("Should stop the build, and exit once it has", t, func() {
+		cmd := exec.Command(os.Args[0],
+			"-test.run=^TestRunScriptSignalWhileBuilding$")
+		// Rebuilding every package keeps the go tool busy.
+		cmd.Env = append(os.Environ(), "GOSCRIPTIFY_TEST_WRAPPER=1",
+			"GOFLAGS=-a")
+		So(cmd.Start(), ShouldBeNil)
+
+		time.Sleep(time.Second)
+		cmd.Process.Signal(syscall.SIGTERM)
+		err := cmd.Wait()
+
+		exitErr, ok := err.(*exec.ExitError)
+		So(ok, ShouldBeTrue)
+		So(exitErr.ExitCode(), ShouldEqual, 128+int(syscall.SIGTERM))
+	})
+}
@@ -0,0 +1,42 @@
+package goscriptify
+
+import (
+	"os"
+	"os/exec"
+)
+
+// forwardedSignals is empty on Windows, which cannot send signals to
+// other processes.
+var forwardedSignals []os.Signal
+
+// setProcessGroup is a noop on Windows, which has no process groups
+// that we can signal.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminateCmd kills the cmd, as Windows has no SIGTERM to send.
+func terminateCmd(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// killCmd forcefully stops the cmd.
+func killCmd(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// forwardSignals is a noop on Windows, which cannot send signals to
+// other processes.
+func forwardSignals(cmd *exec.Cmd) (stop func()) {
+	return func() {}
+}
+
+// forwardDaemonSignals is a noop on Windows, which cannot send signals
+// to other processes.
+func forwardDaemonSignals(fc *frameConn) (stop func()) {
+	return func() {}
+}
+
+// execBin returns ErrExecUnsupported, as Windows cannot replace the
+// running process.
+func execBin(p string, args, env []string) error {
+	return ErrExecUnsupported
+}
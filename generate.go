@@ -0,0 +1,130 @@
+package goscriptify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/leeola/goscriptify/utils"
+)
+
+type GenerateError struct {
+	Exit    int
+	Message string
+}
+
+func (e *GenerateError) Error() string {
+	return fmt.Sprintf("Go generate error:\n\n%s", e.Message)
+}
+
+// GenerateDir runs the go:generate directives of the package in dir.
+func GenerateDir(ctx context.Context, dir string, opts BuildOptions) error {
+	// Generators may write to either stdout or stderr, so both are
+	// kept for the GenerateError.
+	var out bytes.Buffer
+	defer out.Reset()
+
+	err := runGo(ctx, "generate", dir, []string{"generate", "."}, opts,
+		&out, &out)
+	if err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+				return &GenerateError{
+					Exit:    status.ExitStatus(),
+					Message: out.String(),
+				}
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// generateDir runs the go:generate directives of the script dir, if the
+// dir has changed since it was last generated.
+//
+// The key of the dir, after generating, is stored at stampPath. As it
+// includes the generated files, changes to either the inputs or outputs
+// of the generators cause them to be run again.
+func generateDir(ctx context.Context, stampPath, dir string, tc Toolchain,
+	opts ScriptOptions) error {
+	key, err := generateKey(dir, tc)
+	if err != nil {
+		return err
+	}
+
+	if b, err := ioutil.ReadFile(stampPath); err == nil && string(b) == key {
+		return nil
+	}
+
+	err = GenerateDir(ctx, dir, opts.buildOptions(tc))
+	if err != nil {
+		// Remove the stamp, so that a failed generate is always retried.
+		os.Remove(stampPath)
+		return err
+	}
+
+	key, err = generateKey(dir, tc)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(stampPath, []byte(key), 0666)
+}
+
+// generateKey hashes the name, size and mod time of every file within
+// dir, and the toolchain version. Generators may read any file of the
+// dir, but hashing their contents would read every vendored or large
+// file on each compile. Hidden files and dirs are ignored.
+func generateKey(dir string, tc Toolchain) (string, error) {
+	var b strings.Builder
+	err := walkDirFiles(dir, func(p string, fi os.FileInfo) {
+		fmt.Fprintf(&b, "%s\x00%d\x00%d\n", p, fi.Size(),
+			fi.ModTime().UnixNano())
+	})
+	if err != nil {
+		return "", err
+	}
+	return utils.HashString(b.String() + tc.Version), nil
+}
+
+// dirFiles returns every regular file within dir, ignoring hidden files
+// and dirs.
+func dirFiles(dir string) ([]string, error) {
+	var ps []string
+	err := walkDirFiles(dir, func(p string, fi os.FileInfo) {
+		ps = append(ps, p)
+	})
+	return ps, err
+}
+
+// walkDirFiles calls fn for every regular file within dir, ignoring
+// hidden files and dirs.
+func walkDirFiles(dir string, fn func(p string, fi os.FileInfo)) error {
+	return filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dir && strings.HasPrefix(fi.Name(), ".") {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.Mode().IsRegular() {
+			fn(p, fi)
+		}
+		return nil
+	})
+}
+
+// generateStampPath returns the generate stamp path for the given bin.
+func generateStampPath(binDst string) string {
+	return binDst + ".gen"
+}
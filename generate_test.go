@@ -0,0 +1,92 @@
+package goscriptify
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leeola/goscriptify/utils"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// copyGenerateFixture copies the generate_dir fixture to the tmp dir, so
+// that generating does not modify the fixture.
+func copyGenerateFixture() string {
+	src := filepath.Join("_test", "fixtures", "generate_dir")
+	dst := filepath.Join("_test", "tmp", "generate_dir")
+	os.RemoveAll(dst)
+	os.MkdirAll(dst, 0777)
+	for _, f := range []string{"generate.go", "exit.go.in"} {
+		utils.CopyFile(filepath.Join(dst, f), filepath.Join(src, f))
+	}
+	return dst
+}
+
+func TestGenerateDir(t *testing.T) {
+	Convey("Should run the go:generate directives", t, func() {
+		dir := copyGenerateFixture()
+		err := GenerateDir(context.Background(), dir, BuildOptions{})
+		So(err, ShouldBeNil)
+		_, err = os.Stat(filepath.Join(dir, "exit_gen.go"))
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Should return a GenerateError if a generator fails", t, func() {
+		dir := copyGenerateFixture()
+		os.Remove(filepath.Join(dir, "exit.go.in"))
+		err := GenerateDir(context.Background(), dir, BuildOptions{})
+		genErr, ok := err.(*GenerateError)
+		So(ok, ShouldBeTrue)
+		So(genErr.Exit, ShouldNotEqual, 0)
+	})
+}
+
+func TestRunScriptDirGenerate(t *testing.T) {
+	tmpDir := filepath.Join("_test", "tmp")
+	opts := ScriptOptions{
+		Temp:  tmpDir,
+		Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+	}
+
+	Convey("Should not generate unless enabled", t, func() {
+		dir := copyGenerateFixture()
+		_, err := RunScriptDirWithOpts(dir, []string{}, opts)
+		_, ok := err.(*BuildError)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Should generate before building", t, func() {
+		dir := copyGenerateFixture()
+		opts := opts
+		opts.Generate = true
+		exit, err := RunScriptDirWithOpts(dir, []string{}, opts)
+		So(err, ShouldBeNil)
+		So(exit, ShouldEqual, 15)
+
+		Convey("Should only generate when the dir changes", func() {
+			_, err := RunScriptDirWithOpts(dir, []string{}, opts)
+			So(err, ShouldBeNil)
+			b, _ := ioutil.ReadFile(filepath.Join(dir, "generate.log"))
+			So(strings.Count(string(b), "generated"), ShouldEqual, 1)
+
+			os.Remove(filepath.Join(dir, "exit_gen.go"))
+			exit, err := RunScriptDirWithOpts(dir, []string{}, opts)
+			So(err, ShouldBeNil)
+			So(exit, ShouldEqual, 15)
+			b, _ = ioutil.ReadFile(filepath.Join(dir, "generate.log"))
+			So(strings.Count(string(b), "generated"), ShouldEqual, 2)
+
+			later := time.Now().Add(time.Hour)
+			So(os.Chtimes(filepath.Join(dir, "exit.go.in"), later, later),
+				ShouldBeNil)
+			_, err = RunScriptDirWithOpts(dir, []string{}, opts)
+			So(err, ShouldBeNil)
+			b, _ = ioutil.ReadFile(filepath.Join(dir, "generate.log"))
+			So(strings.Count(string(b), "generated"), ShouldEqual, 3)
+		})
+	})
+}
@@ -1,11 +1,116 @@
 //
 // # GoScriptify bin
 //
-// Execute the supplied file as go code.
-package gos
+// Execute the supplied file, or directory, as go code.
+//
+// Usage:
+//
+//	gos [-watch] [-socket path] <script or dir> [args...]
+//	gos -serve path
+//
+// With -watch, the script is rebuilt and restarted whenever its sources
+// change, until interrupted.
+//
+// With -serve, a daemon keeping scripts compiled is served on the Unix
+// socket at path, until interrupted. Scripts are then run by the daemon
+// with -socket, for a faster start.
+package main
 
-import "log"
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/leeola/goscriptify"
+)
 
 func main() {
-	log.Fatal("Error: Not Implemented")
+	watch := flag.Bool("watch", false,
+		"rebuild and restart the script when its sources change")
+	serve := flag.String("serve", "",
+		"serve a daemon keeping scripts compiled on the Unix `socket`")
+	socket := flag.String("socket", "",
+		"run the script with the daemon on the Unix `socket`")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-watch] [-socket path] "+
+			"<script or dir> [args...]\n       %s -serve path\n",
+			os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *serve != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt,
+			syscall.SIGTERM)
+		defer stop()
+
+		d := goscriptify.NewDaemon(goscriptify.NewScriptOptions())
+		err := d.ListenDaemon(ctx, *serve)
+		if err != nil && err != context.Canceled {
+			fatal(err)
+		}
+		return
+	}
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	p, args := flag.Arg(0), flag.Args()[1:]
+	fi, err := os.Stat(p)
+	if err != nil {
+		fatal(err)
+	}
+
+	opts := goscriptify.NewScriptOptions()
+
+	if *watch {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt,
+			syscall.SIGTERM)
+		defer stop()
+
+		if fi.IsDir() {
+			err = goscriptify.WatchScriptDir(ctx, p, args, opts)
+		} else {
+			err = goscriptify.WatchScripts(ctx, []string{p}, args, opts)
+		}
+		if err != nil && err != context.Canceled {
+			fatal(err)
+		}
+		return
+	}
+
+	opts.ForwardSignals = true
+	var res *goscriptify.RunResult
+	if *socket != "" {
+		scripts, dir := []string{p}, ""
+		if fi.IsDir() {
+			scripts, dir = nil, p
+		}
+		res, err = goscriptify.RunDaemon(context.Background(), *socket,
+			scripts, dir, args, opts)
+	} else if fi.IsDir() {
+		res, err = goscriptify.RunScriptDirContext(context.Background(), p,
+			args, opts)
+	} else {
+		res, err = goscriptify.RunScriptsContext(context.Background(),
+			[]string{p}, args, opts)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	os.Exit(res.Status())
+}
+
+func fatal(err error) {
+	if builderr, ok := err.(*goscriptify.BuildError); ok {
+		fmt.Fprint(os.Stderr, builderr.Error())
+	} else {
+		fmt.Fprintf(os.Stderr, "Fatal: %s\n", err)
+	}
+	os.Exit(1)
 }
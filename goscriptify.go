@@ -4,24 +4,31 @@
 package goscriptify
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
-	"syscall"
+	"time"
 
 	"github.com/leeola/goscriptify/utils"
 )
 
 // NewScriptOptions returns a default script options.
 func NewScriptOptions() ScriptOptions {
-	return ScriptOptions{
-		"/tmp/goscriptify",
-		os.Stdin, os.Stdout, os.Stderr,
+	opts := ScriptOptions{
+		Temp:  "/tmp/goscriptify",
+		Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr,
 	}
+
+	// golang.org/dl installs additional toolchains into ~/sdk
+	if home, err := os.UserHomeDir(); err == nil {
+		opts.SDKDirs = []string{filepath.Join(home, "sdk")}
+	}
+
+	return opts
 }
 
 type ScriptOptions struct {
@@ -29,6 +36,122 @@ type ScriptOptions struct {
 	Stdin  io.Reader
 	Stdout io.Writer
 	Stderr io.Writer
+
+	// Timeout, if non-zero, limits the total time spent building and
+	// running the script. Exceeding it returns a TimeoutError.
+	Timeout time.Duration
+
+	// GracePeriod is how long a cancelled script is given to exit after
+	// SIGTERM, before it is sent SIGKILL. Zero uses DefaultGracePeriod.
+	GracePeriod time.Duration
+
+	// Verbose streams the go tool output to Stderr while building,
+	// rather than reporting it in the BuildError when the build fails.
+	Verbose bool
+
+	// BuildFlags are additional flags for go build, eg "-x" or "-v".
+	// The script metadata is merged into any -ldflags given.
+	BuildFlags []string
+
+	// BuildNotice is how long a build may take before a compiling
+	// notice is printed to Stderr, if Stderr is a terminal. Zero uses
+	// DefaultBuildNotice, and a negative value disables the notice.
+	BuildNotice time.Duration
+
+	// SDKDirs are searched for toolchains, after $GOROOT and $PATH, when
+	// a script's `// gos:go` directive requires a newer Go version.
+	SDKDirs []string
+
+	// Vet controls whether scripts are vetted before being run. Vet
+	// results are cached until the script sources change.
+	Vet VetMode
+
+	// VetFlags are the flags given to go vet, such as "-printf" or
+	// "-copylocks" to only run those analyzers.
+	VetFlags []string
+
+	// Generate runs the go:generate directives of script dirs before
+	// building them, whenever the files of the dir have changed.
+	Generate bool
+
+	// CoverDir, if set, builds scripts with coverage instrumentation and
+	// collects the coverage of each run beneath it. See
+	// SummarizeCoverage.
+	CoverDir string
+
+	// ForwardSignals relays catchable signals received by this process,
+	// such as SIGTERM, SIGHUP and SIGUSR1, to the script while it runs.
+	// Those signals no longer terminate this process, so that it exits
+	// only after the script does.
+	//
+	// SIGINT, SIGQUIT and SIGWINCH are not forwarded to a script sharing
+	// our process group, as the terminal already sends them to it.
+	ForwardSignals bool
+
+	// Env holds KEY=VALUE entries added to the environment of the
+	// script, replacing any inherited entries of the same key.
+	Env []string
+
+	// ReplaceEnv runs the script with only Env, rather than adding Env
+	// to the environment inherited from this process.
+	ReplaceEnv bool
+
+	// EnvAllowlist, if non-nil, limits the inherited environment to the
+	// listed keys, such as "PATH" and "HOME". Env is added regardless.
+	EnvAllowlist []string
+
+	// Dir is the working directory of the script. Empty runs the script
+	// in the working directory of this process.
+	Dir string
+
+	// InScriptDir runs the script in its own directory, that of the
+	// first script or the script dir, instead of Dir.
+	InScriptDir bool
+
+	// Limits caps the resources the script may use. Limits are only
+	// supported on Linux.
+	Limits Limits
+
+	// Sandbox, if set, runs the script isolated within Linux namespaces.
+	// Sandboxes are not supported when replacing the process, or by
+	// plugins.
+	Sandbox *Sandbox
+
+	// PTY runs the script in a pseudo-terminal, so that it behaves as
+	// when run interactively, with Stdin copied to the terminal and its
+	// output copied to Stdout. Stderr is unused, as the script writes
+	// both its stdout and stderr to the terminal.
+	//
+	// If Stdin is our terminal it's put into raw mode while the script
+	// runs, and the size of the pseudo-terminal follows it. A Stdin
+	// which is a file, such as our terminal, is no longer read once the
+	// script exits. Pseudo-terminals are only supported on Linux.
+	PTY bool
+
+	// WatchInterval is how often the sources of a watched script are
+	// checked for changes. Zero uses DefaultWatchInterval.
+	WatchInterval time.Duration
+
+	// WatchDebounce is how long the sources of a watched script must be
+	// unchanged before it's restarted, so that a burst of edits restarts
+	// it once. Zero uses DefaultWatchDebounce.
+	WatchDebounce time.Duration
+}
+
+// buildOptions returns the BuildOptions described by the ScriptOptions,
+// building with the given toolchain.
+func (o ScriptOptions) buildOptions(tc Toolchain) BuildOptions {
+	flags := o.BuildFlags
+	if o.CoverDir != "" {
+		flags = append([]string{"-cover"}, flags...)
+	}
+
+	return BuildOptions{
+		Stderr:  o.Stderr,
+		Verbose: o.Verbose,
+		Flags:   flags,
+		Go:      tc.Go,
+	}
 }
 
 func NewScriptPath(h, p string) ScriptPath {
@@ -125,17 +248,32 @@ func CopyScripts(ps []ScriptPath) (err error) {
 // Will search for both "Builder" and "builder", and return the first
 // found file.
 func FindScript(ps []string) (string, error) {
-	var exists, isDir bool
+	p, rejected, ok := lookupScript("", ps)
+	if !ok {
+		return "", &NotFoundError{Scripts: ps, Candidates: rejected}
+	}
+	return p, nil
+}
+
+// lookupScript returns the first of the given scripts that is a readable
+// file relative to cwd, and the candidates rejected before it.
+func lookupScript(cwd string, ps []string) (string, []Candidate, bool) {
+	var rejected []Candidate
 	for _, p := range ps {
-		// Not checking for error here, because we only care about finding
-		// a valid, readable, script. If anything stops that (permissions/etc)
-		// we don't care - it may as well not exist.
-		exists, isDir, _ = utils.Exists(p)
-		if exists && !isDir {
-			return p, nil
+		abs, isDir, rej := checkCandidate(cwd, p)
+		switch {
+		case rej != nil:
+			rejected = append(rejected, *rej)
+		case isDir:
+			rejected = append(rejected, Candidate{
+				Path:   abs,
+				Reason: RejectIsDir,
+			})
+		default:
+			return p, rejected, true
 		}
 	}
-	return "", errors.New(fmt.Sprint("Cannot find", ps))
+	return "", rejected, false
 }
 
 // FindScriptOrDir will find a single file or dir from a list of
@@ -172,63 +310,85 @@ func FindScriptOrDir(ps []string, useDir bool) (path string, isDir bool,
 // can't pass in the full test path for every script, during test usage.
 func findScriptOrDir(cwd string, ps []string, useDir bool) (path string,
 	isDir bool, err error) {
+	path, isDir, rejected, ok := lookupScriptOrDir(cwd, ps, useDir)
+	if !ok {
+		return "", false, &NotFoundError{Scripts: ps, Candidates: rejected}
+	}
+	return path, isDir, nil
+}
+
+// lookupScriptOrDir returns the first of the given scripts, or dirs,
+// that exists relative to cwd, and the candidates rejected before it.
+// See FindScriptOrDir.
+//
+// A subdirectory script without the .go extension stops the lookup, as
+// it can't be built, rather than falling through to a later script.
+func lookupScriptOrDir(cwd string, ps []string, useDir bool) (path string,
+	isDir bool, rejected []Candidate, ok bool) {
 
-	var exists bool
 	for _, p := range ps {
-		// Not checking for error here, because we only care about finding
-		// a valid, readable, script. If anything stops that (permissions/etc)
-		// we don't care - it may as well not exist.
-		exists, isDir, _ = utils.Exists(filepath.Join(cwd, p))
-		if exists {
-			// If path is a dir, we can't use its dir. Return it directly.
-			if isDir || !useDir {
-				return p, isDir, nil
-			}
+		abs, isDir, rej := checkCandidate(cwd, p)
+		if rej != nil {
+			rejected = append(rejected, *rej)
+			continue
+		}
 
-			dir := filepath.Dir(p)
+		// If path is a dir, we can't use its dir. Return it directly.
+		if isDir || !useDir {
+			return p, isDir, rejected, true
+		}
 
-			// If path is in the root (given) dir, return the script
-			if dir == "." {
-				return p, isDir, nil
-			}
+		dir := filepath.Dir(p)
 
-			// We know that it's in a subdir (because the dir isn't .) and
-			// useDir == true, so make sure that the file extension is .go.
-			// If it's not, `go build` will be unable to find the given script
-			// because it will be looking for .go files in the directory.
-			if filepath.Ext(p) != ".go" {
-				return "", false, errors.New("FindScriptOrDir: Subdirectory " +
-					"scripts must use the .go extension")
-			}
+		// If path is in the root (given) dir, return the script
+		if dir == "." {
+			return p, isDir, rejected, true
+		}
 
-			return dir, true, nil
+		// We know that it's in a subdir (because the dir isn't .) and
+		// useDir == true, so make sure that the file extension is .go.
+		// If it's not, `go build` will be unable to find the given script
+		// because it will be looking for .go files in the directory.
+		if filepath.Ext(p) != ".go" {
+			rejected = append(rejected, Candidate{
+				Path:   abs,
+				Reason: RejectExtension,
+			})
+			return "", false, rejected, false
 		}
+
+		return dir, true, rejected, true
 	}
-	return "", false, errors.New(fmt.Sprint("Cannot find", ps))
+	return "", false, rejected, false
 }
 
 // GetBinDest generates a md5 of the source paths, and returns that
 // and the md5 it generated.
-func GetBinDest(sources []string, temp string) (binDst, hash string, err error) {
+//
+// Any additional keys, such as the toolchain version, are included in
+// the md5 so that each combination is given its own bin.
+func GetBinDest(sources []string, temp string, keys ...string) (binDst,
+	hash string, err error) {
 	cwd, err := os.Getwd()
 	if err != nil {
 		return "", "", err
 	}
 
-	return getBinDest(cwd, sources, temp)
+	return getBinDest(cwd, sources, temp, keys...)
 }
 
 // getBinDest is the cwd testable implementation behind GetBinDest
-func getBinDest(cwd string, sources []string, temp string) (binDst, hash string,
-	err error) {
+func getBinDest(cwd string, sources []string, temp string,
+	keys ...string) (binDst, hash string, err error) {
 
 	if len(sources) == 0 {
 		return "", "", errors.New("GetBinDest: A source file is required")
 	}
 
 	// To get a unique "id" of this build, we're combining the abs path
-	// of the cwd and all source names, and then hashing it.
-	h := utils.HashString(strings.Join(append(sources, cwd), ""))
+	// of the cwd, all source names and keys, and then hashing it.
+	id := append(append([]string{}, sources...), cwd)
+	h := utils.HashString(strings.Join(append(id, keys...), ""))
 
 	// Make the hashed bin path. Eg: /tmp/goscriptify/ads7s6adada8asdka
 	binDst = filepath.Join(temp, h)
@@ -239,96 +399,93 @@ func getBinDest(cwd string, sources []string, temp string) (binDst, hash string,
 // Run the given path as an executable, with the supplied args, and
 // forwarding the stdin/out/err.
 //
-// Return the exit status, and any errors encountered.
+// Return the exit status, and any errors encountered. If the executable
+// was terminated by signal N, the exit status is 128+N. RunExecContext
+// returns the full RunResult.
 func RunExec(p string, args []string,
 	stdin io.Reader, stdout, stderr io.Writer) (int, error) {
-	if _, err := os.Stat(p); err != nil {
-		return 0, err
-	}
+	res, err := RunExecContext(context.Background(), p, args, ScriptOptions{
+		Stdin: stdin, Stdout: stdout, Stderr: stderr,
+	})
+	return res.status(), err
+}
 
-	cmd := exec.Command(p, args...)
-	cmd.Stdin = stdin
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
-	err := cmd.Run()
+// RunExecContext runs the given path as an executable, with the supplied
+// args and the stdin/out/err of opts.
+//
+// If ctx is done (or opts.Timeout passes) before the executable exits,
+// its process group is sent SIGTERM, followed by SIGKILL after
+// opts.GracePeriod.
+//
+// The executable, and any script run by goscriptify, is given its
+// location in the environment variables of the scriptinfo package.
+func RunExecContext(ctx context.Context, p string, args []string,
+	opts ScriptOptions) (*RunResult, error) {
+	ctx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	c := &compiled{Bin: p, Script: p, Dir: filepath.Dir(p)}
+	return runExec(ctx, c, args, opts)
+}
+
+// runExec is the implementation of RunExecContext, without applying
+// opts.Timeout. This allows callers to apply the timeout to a larger
+// operation than just the run.
+func runExec(ctx context.Context, c *compiled, args []string,
+	opts ScriptOptions) (*RunResult, error) {
+	proc, err := startProcess(ctx, nil, c, args, opts, false)
 	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				return status.ExitStatus(), nil
-			} else {
-				return 0, err
-			}
-		} else {
-			return 0, err
-		}
+		return nil, err
 	}
-
-	return 0, nil
+	return proc.Wait()
 }
 
 // Copy, compile, and run the given script with the given options.
 //
-// Returns the exit status and any encountered errors
+// Returns the exit status and any encountered errors. If the script was
+// terminated by signal N, the exit status is 128+N. RunScriptsContext
+// returns the full RunResult.
 func RunScriptsWithOpts(scripts, args []string,
 	opts ScriptOptions) (int, error) {
-	binDst, hash, err := GetBinDest(scripts, opts.Temp)
-	if err != nil {
-		return 0, err
-	}
-
-	scriptPaths := NewScriptPaths(hash, scripts)
-
-	err = os.MkdirAll(opts.Temp, 0777)
-	if err != nil {
-		return 0, err
-	}
-
-	err = CopyScripts(scriptPaths)
-	if err != nil {
-		return 0, err
-	}
-
-	// Make a slice of sources for the build command
-	srcs := make([]string, len(scriptPaths))
-	for i, s := range scriptPaths {
-		srcs[i] = s.Generated
-	}
+	res, err := RunScriptsContext(context.Background(), scripts, args, opts)
+	return res.status(), err
+}
 
-	// In the future we will checksum the source(s), but for now we're
-	// just letting go handle the repeat build caching (if at all)
-	err = BuildFiles(binDst, srcs)
-	if err != nil {
-		// Explicitly cleanup if we encounter any errors
-		CleanScripts(scriptPaths)
-		return 0, err
-	}
+// RunScriptsContext is RunScriptsWithOpts, stopping the build or the
+// script if ctx is done (or opts.Timeout passes) before they complete.
+func RunScriptsContext(ctx context.Context, scripts, args []string,
+	opts ScriptOptions) (*RunResult, error) {
+	ctx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
 
-	// Now cleanup any script mess we made.
-	err = CleanScripts(scriptPaths)
+	c, err := compileScripts(ctx, scripts, opts, compileExec)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return RunExec(binDst, args, opts.Stdin, opts.Stdout, opts.Stderr)
+	return runExec(ctx, c, args, opts)
 }
 
+// Compile and run the given go package directory with the given options.
+//
+// Returns the exit status and any encountered errors, as
+// RunScriptsWithOpts. RunScriptDirContext returns the full RunResult.
 func RunScriptDirWithOpts(dir string, args []string, opts ScriptOptions) (int, error) {
-	binDst, _, err := GetBinDest([]string{dir}, opts.Temp)
-	if err != nil {
-		return 0, err
-	}
+	res, err := RunScriptDirContext(context.Background(), dir, args, opts)
+	return res.status(), err
+}
 
-	err = os.MkdirAll(opts.Temp, 0777)
-	if err != nil {
-		return 0, err
-	}
+// RunScriptDirContext is RunScriptDirWithOpts, stopping the build or the
+// script if ctx is done (or opts.Timeout passes) before they complete.
+func RunScriptDirContext(ctx context.Context, dir string, args []string,
+	opts ScriptOptions) (*RunResult, error) {
+	ctx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
 
-	// In the future we will checksum the source(s), but for now we're
-	// just letting go handle the repeat build caching (if at all)
-	err = BuildDir(binDst, dir)
+	c, err := compileDir(ctx, dir, opts, compileExec)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return RunExec(binDst, args, opts.Stdin, opts.Stdout, opts.Stderr)
+	return runExec(ctx, c, args, opts)
 }
@@ -2,11 +2,15 @@ package goscriptify
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -145,7 +149,10 @@ func TestRunScriptsWithOpts(t *testing.T) {
 
 	Convey("Should run a .go file", t, func() {
 		e := filepath.Join("_test", "fixtures", "exit15.go")
-		opts := ScriptOptions{dst, nil, ioutil.Discard, ioutil.Discard}
+		opts := ScriptOptions{
+			Temp:  dst,
+			Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+		}
 		exit, err := RunScriptsWithOpts([]string{e}, []string{}, opts)
 		So(err, ShouldBeNil)
 		So(exit, ShouldEqual, 15)
@@ -153,7 +160,10 @@ func TestRunScriptsWithOpts(t *testing.T) {
 
 	Convey("Should run a no-ext go file", t, func() {
 		e := filepath.Join("_test", "fixtures", "exit15")
-		opts := ScriptOptions{dst, nil, ioutil.Discard, ioutil.Discard}
+		opts := ScriptOptions{
+			Temp:  dst,
+			Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+		}
 		exit, err := RunScriptsWithOpts([]string{e}, []string{}, opts)
 		So(err, ShouldBeNil)
 		So(exit, ShouldEqual, 15)
@@ -167,7 +177,10 @@ func TestRunScriptsWithOpts(t *testing.T) {
 		// Just to be safe, remove the dir ahead of time
 		os.RemoveAll(nestedDstRoot)
 
-		opts := ScriptOptions{nestedDst, nil, ioutil.Discard, ioutil.Discard}
+		opts := ScriptOptions{
+			Temp:  nestedDst,
+			Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+		}
 		RunScriptsWithOpts([]string{src}, []string{}, opts)
 
 		// Now check to make sure the nestedDst exists
@@ -411,3 +424,335 @@ func TestFindScriptOrDirlower(t *testing.T) {
 			So(err, ShouldBeNil)
 		})
 }
+
+func TestRunExecContext(t *testing.T) {
+	fixDir := filepath.Join("_test", "fixtures")
+
+	Convey("Should return a TimeoutError when the timeout passes", t, func() {
+		e := filepath.Join(fixDir, "sleep.bash")
+		start := time.Now()
+		_, err := RunExecContext(context.Background(), e, []string{},
+			ScriptOptions{
+				Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+				Timeout: 100 * time.Millisecond,
+			})
+		_, ok := err.(*TimeoutError)
+		So(ok, ShouldBeTrue)
+		So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+	})
+
+	Convey("Should return the context error when cancelled", t, func() {
+		e := filepath.Join(fixDir, "sleep.bash")
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+		_, err := RunExecContext(ctx, e, []string{}, ScriptOptions{
+			Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+		})
+		So(err, ShouldEqual, context.Canceled)
+	})
+
+	Convey("Should kill scripts that ignore SIGTERM after the grace period",
+		t, func() {
+			e := filepath.Join(fixDir, "ignoreterm.bash")
+			start := time.Now()
+			_, err := RunExecContext(context.Background(), e, []string{},
+				ScriptOptions{
+					Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+					Timeout:     100 * time.Millisecond,
+					GracePeriod: 100 * time.Millisecond,
+				})
+			_, ok := err.(*TimeoutError)
+			So(ok, ShouldBeTrue)
+			So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+		})
+
+	Convey("Should not wait for children holding the output open", t, func() {
+		e := filepath.Join(fixDir, "background.bash")
+		var stdout bytes.Buffer
+		start := time.Now()
+		res, err := RunExecContext(context.Background(), e, []string{},
+			ScriptOptions{
+				Stdout: &stdout, Stderr: ioutil.Discard,
+				GracePeriod: 100 * time.Millisecond,
+			})
+		So(err, ShouldBeNil)
+		So(res.ExitCode, ShouldEqual, 0)
+		So(stdout.String(), ShouldEqual, "started\n")
+		So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+	})
+}
+
+func TestRunScriptsMetadata(t *testing.T) {
+	src := filepath.Join("_test", "fixtures", "scriptinfo.go")
+	tmpDir := filepath.Join("_test", "tmp")
+
+	Convey("Should stamp the script metadata", t, func() {
+		var stdout bytes.Buffer
+		_, err := RunScriptsWithOpts([]string{src}, []string{}, ScriptOptions{
+			Temp:  tmpDir,
+			Stdin: nil, Stdout: &stdout, Stderr: ioutil.Discard,
+		})
+		So(err, ShouldBeNil)
+
+		abs, _ := filepath.Abs(src)
+		lines := strings.Split(stdout.String(), "\n")
+		So(lines[0], ShouldEqual, abs)
+		So(len(lines[1]), ShouldEqual, 32)
+		So(lines[2], ShouldEqual, "false")
+		So(lines[3], ShouldEqual, Version)
+	})
+
+	Convey("Should stamp the metadata with user -ldflags", t, func() {
+		var stdout bytes.Buffer
+		_, err := RunScriptsWithOpts([]string{src}, []string{}, ScriptOptions{
+			Temp:  tmpDir,
+			Stdin: nil, Stdout: &stdout, Stderr: ioutil.Discard,
+			BuildFlags: []string{"-ldflags=-s -w"},
+		})
+		So(err, ShouldBeNil)
+
+		lines := strings.Split(stdout.String(), "\n")
+		So(len(lines[1]), ShouldEqual, 32)
+		So(lines[3], ShouldEqual, Version)
+	})
+
+	Convey("Should stamp the metadata with quoted user -ldflags", t, func() {
+		var stdout bytes.Buffer
+		_, err := RunScriptsWithOpts([]string{src}, []string{}, ScriptOptions{
+			Temp:  tmpDir,
+			Stdin: nil, Stdout: &stdout, Stderr: ioutil.Discard,
+			BuildFlags: []string{`-ldflags=-X "main.unused=a b" -s`},
+		})
+		So(err, ShouldBeNil)
+
+		lines := strings.Split(stdout.String(), "\n")
+		So(len(lines[1]), ShouldEqual, 32)
+		So(lines[3], ShouldEqual, Version)
+	})
+}
+
+func TestWithLdflags(t *testing.T) {
+	ld := []string{"-X", "a=b"}
+	withLd := func(flags ...string) []string {
+		out, err := withLdflags(ld, flags)
+		So(err, ShouldBeNil)
+		return out
+	}
+
+	Convey("Should add the linker flags", t, func() {
+		So(withLd("-v"), ShouldResemble, []string{"-ldflags=-X a=b", "-v"})
+	})
+
+	Convey("Should merge into user -ldflags", t, func() {
+		So(withLd("-ldflags=-s -w", "-v"), ShouldResemble,
+			[]string{"-ldflags=-X a=b", "-ldflags=-X a=b -s -w", "-v"})
+		So(withLd("--ldflags", "-s"), ShouldResemble,
+			[]string{"-ldflags=-X a=b", "-ldflags=-X a=b -s"})
+		So(withLd("-ldflags=all=-s"), ShouldResemble,
+			[]string{"-ldflags=-X a=b", "-ldflags=all=-X a=b -s"})
+	})
+
+	Convey("Should keep the quoting of user -ldflags", t, func() {
+		So(withLd(`-ldflags=-X "main.v=a b" -X 'main.q="c"'`), ShouldResemble,
+			[]string{"-ldflags=-X a=b",
+				`-ldflags=-X a=b -X 'main.v=a b' -X 'main.q="c"'`})
+	})
+
+	Convey("Should quote the linker flags", t, func() {
+		out, err := withLdflags([]string{"-X", "a=b c", "-X", "d='e'"}, nil)
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, []string{`-ldflags=-X 'a=b c' -X "d='e'"`})
+		args, err := splitQuoted(strings.TrimPrefix(out[0], "-ldflags="))
+		So(err, ShouldBeNil)
+		So(args, ShouldResemble, []string{"-X", "a=b c", "-X", "d='e'"})
+	})
+
+	Convey("Should reject flags which can't be quoted", t, func() {
+		_, err := withLdflags([]string{"-X", `a='b' "c"`}, nil)
+		So(err, ShouldNotBeNil)
+		_, err = withLdflags(ld, []string{`-ldflags=-X "a=b`})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestRunExecSignal(t *testing.T) {
+	e := filepath.Join("_test", "fixtures", "killself.bash")
+
+	Convey("Should report the terminating signal", t, func() {
+		res, err := RunExecContext(context.Background(), e, []string{},
+			ScriptOptions{Stdout: ioutil.Discard, Stderr: ioutil.Discard})
+		So(err, ShouldBeNil)
+		So(res.Signaled(), ShouldBeTrue)
+		So(res.Signal, ShouldEqual, syscall.SIGTERM)
+		So(res.ExitCode, ShouldEqual, -1)
+		So(res.Status(), ShouldEqual, 128+int(syscall.SIGTERM))
+	})
+
+	Convey("Should return 128+N as the exit status", t, func() {
+		exit, err := RunExec(e, []string{}, nil, ioutil.Discard, ioutil.Discard)
+		So(err, ShouldBeNil)
+		So(exit, ShouldEqual, 128+int(syscall.SIGTERM))
+	})
+}
+
+func TestRunScriptsEnv(t *testing.T) {
+	src := filepath.Join("_test", "fixtures", "env.go")
+	tmpDir := filepath.Join("_test", "tmp")
+	os.Setenv("GOSCRIPTIFY_TEST_A", "a")
+	os.Setenv("GOSCRIPTIFY_TEST_B", "b")
+	defer os.Unsetenv("GOSCRIPTIFY_TEST_A")
+	defer os.Unsetenv("GOSCRIPTIFY_TEST_B")
+
+	run := func(opts ScriptOptions) []string {
+		var stdout bytes.Buffer
+		opts.Temp = tmpDir
+		opts.Stdout, opts.Stderr = &stdout, ioutil.Discard
+		exit, err := RunScriptsWithOpts([]string{src}, []string{
+			"GOSCRIPTIFY_TEST_A", "GOSCRIPTIFY_TEST_B", "GOSCRIPTIFY_TEST_C",
+		}, opts)
+		So(err, ShouldBeNil)
+		So(exit, ShouldEqual, 0)
+		return strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	}
+
+	Convey("Should merge Env into the inherited environment", t, func() {
+		lines := run(ScriptOptions{
+			Env: []string{"GOSCRIPTIFY_TEST_B=x", "GOSCRIPTIFY_TEST_C=c"},
+		})
+		wd, _ := os.Getwd()
+		So(lines[0], ShouldEqual, filepath.Base(wd))
+		So(lines[1], ShouldEqual, "GOSCRIPTIFY_TEST_A=a true")
+		So(lines[2], ShouldEqual, "GOSCRIPTIFY_TEST_B=x true")
+		So(lines[3], ShouldEqual, "GOSCRIPTIFY_TEST_C=c true")
+	})
+
+	Convey("Should replace the inherited environment", t, func() {
+		lines := run(ScriptOptions{
+			Env: []string{"GOSCRIPTIFY_TEST_C=c"}, ReplaceEnv: true,
+		})
+		So(lines[1], ShouldEqual, "GOSCRIPTIFY_TEST_A= false")
+		So(lines[2], ShouldEqual, "GOSCRIPTIFY_TEST_B= false")
+		So(lines[3], ShouldEqual, "GOSCRIPTIFY_TEST_C=c true")
+	})
+
+	Convey("Should only inherit allowed keys", t, func() {
+		lines := run(ScriptOptions{
+			EnvAllowlist: []string{"GOSCRIPTIFY_TEST_B"},
+		})
+		So(lines[1], ShouldEqual, "GOSCRIPTIFY_TEST_A= false")
+		So(lines[2], ShouldEqual, "GOSCRIPTIFY_TEST_B=b true")
+	})
+
+	Convey("Should run in Dir", t, func() {
+		lines := run(ScriptOptions{Dir: "_test"})
+		So(lines[0], ShouldEqual, "_test")
+	})
+
+	Convey("Should run in the script's own dir", t, func() {
+		lines := run(ScriptOptions{Dir: "_test", InScriptDir: true})
+		So(lines[0], ShouldEqual, "fixtures")
+	})
+
+	Convey("Should set the location of the script", t, func() {
+		var stdout bytes.Buffer
+		_, err := RunScriptsWithOpts([]string{src}, []string{
+			"GOSCRIPTIFY_SCRIPT", "GOSCRIPTIFY_SCRIPT_DIR",
+			"GOSCRIPTIFY_VERSION", "GOSCRIPTIFY_DEPTH",
+		}, ScriptOptions{Temp: tmpDir, Stdout: &stdout, Stderr: ioutil.Discard})
+		So(err, ShouldBeNil)
+
+		abs, _ := filepath.Abs(src)
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		So(lines[1], ShouldEqual, "GOSCRIPTIFY_SCRIPT="+abs+" true")
+		So(lines[2], ShouldEqual,
+			"GOSCRIPTIFY_SCRIPT_DIR="+filepath.Dir(abs)+" true")
+		So(lines[3], ShouldEqual, "GOSCRIPTIFY_VERSION="+Version+" true")
+		So(lines[4], ShouldEqual, "GOSCRIPTIFY_DEPTH=1 true")
+	})
+}
+
+func TestRunScriptsResult(t *testing.T) {
+	src := filepath.Join("_test", "fixtures", "exit15.go")
+	tmpDir := filepath.Join("_test", "tmp")
+	opts := ScriptOptions{Temp: tmpDir, Stdout: ioutil.Discard,
+		Stderr: ioutil.Discard}
+
+	Convey("Should describe the build and run", t, func() {
+		// Build once, so that the next run is cached.
+		_, err := RunScriptsContext(context.Background(), []string{src},
+			[]string{}, opts)
+		So(err, ShouldBeNil)
+
+		res, err := RunScriptsContext(context.Background(), []string{src},
+			[]string{}, opts)
+		So(err, ShouldBeNil)
+		So(res.ExitCode, ShouldEqual, 15)
+		So(res.Cached, ShouldBeTrue)
+		So(res.BuildTime, ShouldBeGreaterThan, 0)
+		So(res.WallTime, ShouldBeGreaterThan, 0)
+		So(res.MaxRSS, ShouldBeGreaterThan, 0)
+
+		absTmp, _ := filepath.Abs(tmpDir)
+		So(filepath.Dir(res.Bin), ShouldEqual, absTmp)
+	})
+}
+
+func TestStartExec(t *testing.T) {
+	fixDir := filepath.Join("_test", "fixtures")
+
+	Convey("Should pipe the stdio of the script", t, func() {
+		e := filepath.Join(fixDir, "echoinput.bash")
+		proc, err := StartExec(context.Background(), e, []string{},
+			ScriptOptions{Stderr: ioutil.Discard})
+		So(err, ShouldBeNil)
+		So(proc.PID(), ShouldBeGreaterThan, 0)
+		So(proc.Stderr, ShouldBeNil)
+
+		fmt.Fprintln(proc.Stdin, "foo")
+		proc.Stdin.Close()
+		b, err := ioutil.ReadAll(proc.Stdout)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "Echoing foo")
+
+		res, err := proc.Wait()
+		So(err, ShouldBeNil)
+		So(res.ExitCode, ShouldEqual, 0)
+	})
+
+	Convey("Should signal the script", t, func() {
+		e := filepath.Join(fixDir, "sleep.bash")
+		proc, err := StartExec(context.Background(), e, []string{},
+			ScriptOptions{})
+		So(err, ShouldBeNil)
+
+		So(proc.Signal(syscall.SIGKILL), ShouldBeNil)
+		<-proc.Done()
+		res, err := proc.Wait()
+		So(err, ShouldBeNil)
+		So(res.Signal, ShouldEqual, syscall.SIGKILL)
+		So(proc.Signal(syscall.SIGKILL), ShouldEqual, os.ErrProcessDone)
+	})
+}
+
+func TestStartScripts(t *testing.T) {
+	src := filepath.Join("_test", "fixtures", "exit15.go")
+	tmpDir := filepath.Join("_test", "tmp")
+
+	Convey("Should start several scripts at once", t, func() {
+		var procs []*Process
+		for i := 0; i < 3; i++ {
+			proc, err := StartScripts(context.Background(), []string{src},
+				[]string{}, ScriptOptions{Temp: tmpDir})
+			So(err, ShouldBeNil)
+			procs = append(procs, proc)
+		}
+
+		for _, proc := range procs {
+			b, _ := ioutil.ReadAll(proc.Stdout)
+			So(string(b), ShouldEqual, "STDOUT: Exiting 15")
+			res, err := proc.Wait()
+			So(err, ShouldBeNil)
+			So(res.ExitCode, ShouldEqual, 15)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package goscriptify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/leeola/goscriptify/utils"
+)
+
+// buildHelper compiles the named helper process from its source into
+// opts.Temp if it isn't already, and returns the absolute path of its
+// bin. Helpers, such as the sandbox init process, are run in place of a
+// script to set it up before it runs.
+func buildHelper(ctx context.Context, name, src string,
+	opts ScriptOptions) (string, error) {
+	temp := opts.Temp
+	if temp == "" {
+		temp = filepath.Join(os.TempDir(), "goscriptify")
+	}
+
+	// The helper is started from the working directory of the script,
+	// so its path must not be relative.
+	binDst, err := filepath.Abs(filepath.Join(temp,
+		name+"-"+utils.HashString(src)))
+	if err != nil {
+		return "", err
+	}
+	if exists, _, err := utils.Exists(binDst); exists || err != nil {
+		return binDst, err
+	}
+
+	if err := os.MkdirAll(temp, 0777); err != nil {
+		return "", err
+	}
+
+	// A unique source file, so that concurrent builds don't collide.
+	f, err := os.CreateTemp(temp, name+"-*.go")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = BuildFilesWithOpts(ctx, binDst, []string{f.Name()}, BuildOptions{
+		Stderr: opts.Stderr, Verbose: opts.Verbose,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return binDst, nil
+}
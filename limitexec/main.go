@@ -0,0 +1,63 @@
+//go:build linux
+// +build linux
+
+// # Limit Exec
+//
+// Command limitexec applies rlimits to itself, and then replaces itself
+// with a script. goscriptify compiles it, and starts scripts through it
+// when ScriptOptions.Limits are given, so that the limits apply before
+// the script runs any code.
+//
+// Usage:
+//
+//	limitexec <rlimits json> <script> [args...]
+//
+// The script keeps the PID, stdio and environment of limitexec. If the
+// limits cannot be applied, limitexec exits with 126 as a shell would
+// for a script that cannot be run.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// rlimit is a resource limit given by goscriptify, and must match its
+// rlimit json.
+type rlimit struct {
+	Resource int
+	Cur      uint64
+	Max      uint64
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		fatal(fmt.Errorf("usage: limitexec <rlimits json> <script> [args...]"))
+	}
+
+	var rs []rlimit
+	if err := json.Unmarshal([]byte(os.Args[1]), &rs); err != nil {
+		fatal(err)
+	}
+
+	// syscall.Setrlimit is used, rather than prlimit, as it also keeps
+	// the exec from restoring the open file limit Go started with.
+	for _, r := range rs {
+		lim := syscall.Rlimit{Cur: r.Cur, Max: r.Max}
+		if err := syscall.Setrlimit(r.Resource, &lim); err != nil {
+			fatal(fmt.Errorf("setting rlimit %d: %s", r.Resource, err))
+		}
+	}
+
+	script := os.Args[2]
+	err := syscall.Exec(script, os.Args[2:], os.Environ())
+	fatal(fmt.Errorf("exec %s: %s", script, err))
+}
+
+// fatal reports an error, and exits with 126.
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "goscriptify limits: %s\n", err)
+	os.Exit(126)
+}
@@ -0,0 +1,90 @@
+package goscriptify
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrLimitsUnsupported is returned when ScriptOptions.Limits are given
+// on a platform that cannot apply them.
+var ErrLimitsUnsupported = errors.New("Script limits are only supported " +
+	"on Linux")
+
+// Limits caps the resources a script may use. Zero values are
+// unlimited.
+//
+// The limits are applied as rlimits to the script before it runs any
+// code, and are inherited by its children. If Cgroup is set, Memory and
+// Procs are instead applied to a cgroup containing the script and all of
+// its children.
+//
+// Only exceeding CPU, or the Memory and Procs of a Cgroup, is reported
+// in RunResult.LimitExceeded. The other limits fail the calls made by
+// the script, such as with EMFILE or ENOMEM, which we cannot observe.
+type Limits struct {
+	// CPU is the CPU time the script may use, rounded up to the second.
+	// The script is sent SIGXCPU once it's exceeded, and then SIGKILL a
+	// second later.
+	CPU time.Duration
+
+	// Memory is the address space the script may use in bytes. With a
+	// Cgroup, it's instead the memory the script may use before it's
+	// killed by the OOM killer.
+	Memory int64
+
+	// Files is the number of files the script may have open at once.
+	// Opening more fails with EMFILE within the script.
+	Files int
+
+	// Procs is the number of processes the user running the script may
+	// have, which is not enforced for root. With a Cgroup, it's instead
+	// the number of processes and threads in the script's cgroup.
+	Procs int
+
+	// Cgroup is the path to a cgroup v2 directory delegated to us, such
+	// as by systemd's Delegate=. A child cgroup is created beneath it for
+	// each run, and removed once the script exits.
+	Cgroup string
+}
+
+// IsZero returns whether the limits are all unlimited.
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// Limit is a limit that a script exceeded.
+type Limit int
+
+const (
+	// LimitNone is reported when no limit was detectably exceeded.
+	LimitNone Limit = iota
+
+	// LimitCPU is reported when the script was killed for exceeding
+	// Limits.CPU.
+	LimitCPU
+
+	// LimitMemory is reported when the script was killed by the OOM
+	// killer of its cgroup. Exceeding an rlimit on the address space
+	// instead fails allocations within the script.
+	LimitMemory
+
+	// LimitProcs is reported when the script tried to exceed the
+	// process limit of its cgroup. Exceeding the rlimit instead fails
+	// the fork within the script.
+	LimitProcs
+)
+
+func (l Limit) String() string {
+	switch l {
+	case LimitNone:
+		return "none"
+	case LimitCPU:
+		return "cpu"
+	case LimitMemory:
+		return "memory"
+	case LimitProcs:
+		return "procs"
+	default:
+		return "unknown"
+	}
+}
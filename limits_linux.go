@@ -0,0 +1,294 @@
+package goscriptify
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// cgroupSeq numbers the cgroups created by this process.
+var cgroupSeq uint64
+
+// rlimit is a resource limit to apply to a script.
+type rlimit struct {
+	resource int
+	limit    syscall.Rlimit
+}
+
+// limited is a started cmd with Limits applied.
+type limited struct {
+	limits Limits
+
+	// cgroup is the cgroup created for the cmd, if any.
+	cgroup string
+}
+
+// limitExecSrc is the source of the limit exec helper, which is compiled
+// into ScriptOptions.Temp on first use.
+//
+//go:embed limitexec/main.go
+var limitExecSrc string
+
+// startLimited starts the cmd with start, applying opts.Limits. The
+// returned limited should be checked and released once the cmd has
+// exited. If no limits are given, it is nil.
+//
+// To apply the rlimits before the cmd runs any code, it's started
+// through the limit exec helper, which sets the rlimits on itself and
+// then execs the cmd.
+func startLimited(ctx context.Context, cmd *exec.Cmd, opts ScriptOptions,
+	start func() error) (*limited, error) {
+	l := opts.Limits
+	if l.IsZero() {
+		return nil, start()
+	}
+
+	if rlimits := l.rlimits(); len(rlimits) > 0 {
+		if err := limitCmd(ctx, cmd, rlimits, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	lim := &limited{limits: l}
+
+	if l.Cgroup != "" {
+		dir, err := createCgroup(l)
+		if err != nil {
+			return nil, err
+		}
+		lim.cgroup = dir
+
+		f, err := os.Open(dir)
+		if err != nil {
+			lim.release()
+			return nil, err
+		}
+		defer f.Close()
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(f.Fd())
+	}
+
+	if err := start(); err != nil {
+		lim.release()
+		return nil, err
+	}
+
+	return lim, nil
+}
+
+// limitCmd changes the cmd to run its executable through the limit exec
+// helper, which applies the rlimits first.
+func limitCmd(ctx context.Context, cmd *exec.Cmd, rlimits []rlimit,
+	opts ScriptOptions) error {
+	helper, err := buildHelper(ctx, "limit-exec", limitExecSrc, opts)
+	if err != nil {
+		return err
+	}
+
+	// The rlimits json must match that of the helper.
+	type jsonRlimit struct {
+		Resource int
+		Cur      uint64
+		Max      uint64
+	}
+	rs := make([]jsonRlimit, len(rlimits))
+	for i, r := range rlimits {
+		rs[i] = jsonRlimit{r.resource, r.limit.Cur, r.limit.Max}
+	}
+	b, err := json.Marshal(rs)
+	if err != nil {
+		return err
+	}
+
+	cmd.Args = append([]string{helper, string(b), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = helper
+	return nil
+}
+
+// rlimits returns the rlimits to apply for the limits. Memory and Procs
+// are left to the cgroup, if there is one.
+func (l Limits) rlimits() []rlimit {
+	var rs []rlimit
+	add := func(resource int, cur uint64, max uint64) {
+		rs = append(rs, rlimit{resource, syscall.Rlimit{Cur: cur, Max: max}})
+	}
+
+	if l.CPU > 0 {
+		secs := uint64((l.CPU + time.Second - 1) / time.Second)
+		// The soft limit sends SIGXCPU, and the hard limit SIGKILL.
+		add(syscall.RLIMIT_CPU, secs, secs+1)
+	}
+	if l.Memory > 0 && l.Cgroup == "" {
+		add(syscall.RLIMIT_AS, uint64(l.Memory), uint64(l.Memory))
+	}
+	if l.Files > 0 {
+		add(syscall.RLIMIT_NOFILE, uint64(l.Files), uint64(l.Files))
+	}
+	if l.Procs > 0 && l.Cgroup == "" {
+		add(rlimitNproc, uint64(l.Procs), uint64(l.Procs))
+	}
+	return rs
+}
+
+// rlimitNproc is RLIMIT_NPROC, which the syscall package lacks.
+const rlimitNproc = 0x6
+
+// createCgroup creates a child cgroup of l.Cgroup with the memory and
+// process limits of l, returning its path.
+func createCgroup(l Limits) (string, error) {
+	name := fmt.Sprintf("goscriptify-%d-%d", os.Getpid(),
+		atomic.AddUint64(&cgroupSeq, 1))
+	dir := filepath.Join(l.Cgroup, name)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return "", err
+	}
+
+	var err error
+	if l.Memory > 0 {
+		err = writeCgroup(dir, "memory.max", strconv.FormatInt(l.Memory, 10))
+	}
+	if err == nil && l.Procs > 0 {
+		err = writeCgroup(dir, "pids.max", strconv.Itoa(l.Procs))
+	}
+	if err != nil {
+		os.Remove(dir)
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// writeCgroup writes the value to the named interface file of the
+// cgroup dir.
+func writeCgroup(dir, name, value string) error {
+	return os.WriteFile(filepath.Join(dir, name), []byte(value), 0644)
+}
+
+// cgroupEvent returns the count of the named event from the named
+// events file of the cgroup dir, or 0 if it cannot be read.
+func cgroupEvent(dir, file, event string) int {
+	f, err := os.Open(filepath.Join(dir, file))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && fields[0] == event {
+			n, _ := strconv.Atoi(fields[1])
+			return n
+		}
+	}
+	return 0
+}
+
+// check sets the LimitExceeded of the result of the exited cmd. stopped
+// is whether we stopped the cmd ourselves, such as for its Timeout.
+func (l *limited) check(res *RunResult, stopped bool) {
+	if l == nil || res == nil {
+		return
+	}
+
+	switch {
+	case l.cgroup != "" && cgroupEvent(l.cgroup, "memory.events",
+		"oom_kill") > 0:
+		res.LimitExceeded = LimitMemory
+	case l.cgroup != "" && cgroupEvent(l.cgroup, "pids.events", "max") > 0:
+		res.LimitExceeded = LimitProcs
+	case l.limits.CPU > 0 && exceededCPU(res, l.limits.CPU, stopped):
+		res.LimitExceeded = LimitCPU
+	}
+}
+
+// exceededCPU returns whether the result is of a script killed for
+// using more than the cpu limit. The kernel sends SIGXCPU at the limit,
+// and SIGKILL a second later if the script survives it. A SIGKILL is
+// only attributed to the limit if we didn't send it ourselves.
+func exceededCPU(res *RunResult, cpu time.Duration, stopped bool) bool {
+	switch res.Signal {
+	case syscall.SIGXCPU:
+		return true
+	case syscall.SIGKILL:
+		return !stopped && res.UserTime+res.SystemTime >= cpu
+	}
+	return false
+}
+
+// release removes the cgroup created for the cmd, killing anything
+// left running within it.
+func (l *limited) release() {
+	if l == nil || l.cgroup == "" {
+		return
+	}
+
+	// cgroup.kill requires Linux 5.14, but the cgroup is usually empty
+	// by now regardless.
+	writeCgroup(l.cgroup, "cgroup.kill", "1")
+	for i := 0; i < 50; i++ {
+		if err := os.Remove(l.cgroup); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// limitSelf applies the rlimits of l to this process, which is about to
+// be replaced by a script. A Cgroup cannot be used, as nothing would
+// remain to remove it once the script exits.
+//
+// The returned func restores the previous rlimits, in case the exec
+// fails. Hard limits which were lowered can only be raised again with
+// CAP_SYS_RESOURCE, so only the soft limits may be restored.
+func limitSelf(l Limits) (restore func(), err error) {
+	if l.Cgroup != "" {
+		return nil, fmt.Errorf("goscriptify: a limits cgroup cannot be " +
+			"used when replacing the process")
+	}
+
+	var old []rlimit
+	restore = func() {
+		for i := len(old) - 1; i >= 0; i-- {
+			r := old[i]
+			if syscall.Setrlimit(r.resource, &r.limit) != nil {
+				// Keep the lowered hard limit, restoring what we can.
+				var cur syscall.Rlimit
+				if syscall.Getrlimit(r.resource, &cur) == nil {
+					cur.Cur = r.limit.Cur
+					if cur.Cur > cur.Max {
+						cur.Cur = cur.Max
+					}
+					syscall.Setrlimit(r.resource, &cur)
+				}
+			}
+		}
+	}
+
+	for _, r := range l.rlimits() {
+		prev := rlimit{resource: r.resource}
+		if err := syscall.Getrlimit(r.resource, &prev.limit); err != nil {
+			restore()
+			return nil, err
+		}
+		if err := syscall.Setrlimit(r.resource, &r.limit); err != nil {
+			restore()
+			return nil, err
+		}
+		old = append(old, prev)
+	}
+	return restore, nil
+}
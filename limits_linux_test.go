@@ -0,0 +1,101 @@
+package goscriptify
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLimits(t *testing.T) {
+	fixDir := filepath.Join("_test", "fixtures")
+
+	Convey("Should apply rlimits to the script", t, func() {
+		var stdout bytes.Buffer
+		e := filepath.Join(fixDir, "ulimits.bash")
+		res, err := RunExecContext(context.Background(), e, []string{},
+			ScriptOptions{
+				Stdout: &stdout, Stderr: ioutil.Discard,
+				Limits: Limits{Files: 17, Memory: 512 << 20},
+			})
+		So(err, ShouldBeNil)
+		So(res.ExitCode, ShouldEqual, 0)
+		So(stdout.String(), ShouldEqual, "17\n524288\n")
+		So(res.LimitExceeded, ShouldEqual, LimitNone)
+	})
+
+	Convey("Should report exceeding the cpu limit", t, func() {
+		e := filepath.Join(fixDir, "spin.bash")
+		res, err := RunExecContext(context.Background(), e, []string{},
+			ScriptOptions{
+				Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+				Timeout: 10 * time.Second,
+				Limits:  Limits{CPU: time.Second},
+			})
+		So(err, ShouldBeNil)
+		So(res.Signaled(), ShouldBeTrue)
+		So(res.LimitExceeded, ShouldEqual, LimitCPU)
+	})
+
+	Convey("Should not report a kill of ours as exceeding the cpu limit", t,
+		func() {
+			res := &RunResult{Signal: syscall.SIGKILL, UserTime: 2 * time.Second}
+			So(exceededCPU(res, time.Second, true), ShouldBeFalse)
+			So(exceededCPU(res, time.Second, false), ShouldBeTrue)
+			res.Signal = syscall.SIGXCPU
+			So(exceededCPU(res, time.Second, true), ShouldBeTrue)
+		})
+}
+
+func TestExecCompiledRestore(t *testing.T) {
+	Convey("Should restore the process if the exec fails", t, func() {
+		dir, err := ioutil.TempDir("", "goscriptify-exec")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		// Executable, but not something the kernel can exec.
+		bin := filepath.Join(dir, "notbin")
+		So(ioutil.WriteFile(bin, []byte("\x00\x01\x02\x03"), 0755),
+			ShouldBeNil)
+
+		// Changing the soft limit, below the hard limit, is always allowed
+		// and can be undone.
+		var orig syscall.Rlimit
+		So(syscall.Getrlimit(syscall.RLIMIT_NOFILE, &orig), ShouldBeNil)
+		defer syscall.Setrlimit(syscall.RLIMIT_NOFILE, &orig)
+		before := syscall.Rlimit{Cur: orig.Max - 1, Max: orig.Max}
+		So(syscall.Setrlimit(syscall.RLIMIT_NOFILE, &before), ShouldBeNil)
+		cwd, err := os.Getwd()
+		So(err, ShouldBeNil)
+
+		c := &compiled{Bin: bin, Script: bin, Dir: dir}
+		err = execCompiled(c, []string{}, ScriptOptions{
+			InScriptDir: true,
+			Limits:      Limits{Files: int(before.Max)},
+		})
+		So(err, ShouldNotBeNil)
+
+		var after syscall.Rlimit
+		So(syscall.Getrlimit(syscall.RLIMIT_NOFILE, &after), ShouldBeNil)
+		So(after, ShouldResemble, before)
+		wd, err := os.Getwd()
+		So(err, ShouldBeNil)
+		So(wd, ShouldEqual, cwd)
+	})
+
+	Convey("Should not change the process for a missing bin", t, func() {
+		cwd, err := os.Getwd()
+		So(err, ShouldBeNil)
+		c := &compiled{Bin: "missing", Script: "missing", Dir: os.TempDir()}
+		err = execCompiled(c, []string{}, ScriptOptions{InScriptDir: true})
+		So(os.IsNotExist(err), ShouldBeTrue)
+		wd, _ := os.Getwd()
+		So(wd, ShouldEqual, cwd)
+	})
+}
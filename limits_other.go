@@ -0,0 +1,38 @@
+//go:build !linux
+// +build !linux
+
+package goscriptify
+
+import (
+	"context"
+	"os/exec"
+)
+
+// limited is a started cmd with Limits applied, which are unsupported
+// on this platform.
+type limited struct{}
+
+// startLimited starts the cmd with start, returning ErrLimitsUnsupported
+// if any limits were given.
+func startLimited(ctx context.Context, cmd *exec.Cmd, opts ScriptOptions,
+	start func() error) (*limited, error) {
+	if !opts.Limits.IsZero() {
+		return nil, ErrLimitsUnsupported
+	}
+	return nil, start()
+}
+
+// check is a noop, as no limits are applied.
+func (l *limited) check(res *RunResult, stopped bool) {}
+
+// release is a noop, as no limits are applied.
+func (l *limited) release() {}
+
+// limitSelf returns ErrLimitsUnsupported if any limits were given.
+// Otherwise there is nothing to restore.
+func limitSelf(l Limits) (restore func(), err error) {
+	if !l.IsZero() {
+		return nil, ErrLimitsUnsupported
+	}
+	return func() {}, nil
+}
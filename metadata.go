@@ -0,0 +1,202 @@
+package goscriptify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/leeola/goscriptify/utils"
+)
+
+// Version is the version of goscriptify, stamped into every compiled
+// script.
+const Version = "0.1.0"
+
+// scriptInfoPkg is the import path of the package that compiled scripts
+// can import to read their metadata.
+const scriptInfoPkg = "github.com/leeola/goscriptify/scriptinfo"
+
+// metadata is stamped into a compiled script, and stored next to its
+// bin so that the build time is kept while the script is unchanged.
+type metadata struct {
+	Hash      string
+	BuildTime time.Time
+}
+
+// metadataFlags returns the linker flags stamping the metadata of the script
+// with the given original paths and sources into the scriptinfo package.
+//
+// The build time is only updated when the source hash changes, as the
+// stamped flags would otherwise change with every build, defeating the
+// go build cache.
+func metadataFlags(metaPath string, paths, srcs []string) ([]string, error) {
+	h, err := utils.HashFiles(srcs)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta metadata
+	if b, err := ioutil.ReadFile(metaPath); err == nil {
+		json.Unmarshal(b, &meta)
+	}
+
+	if meta.Hash != h || meta.BuildTime.IsZero() {
+		meta = metadata{Hash: h, BuildTime: time.Now().UTC()}
+		b, err := json.Marshal(meta)
+		if err != nil {
+			return nil, err
+		}
+		err = ioutil.WriteFile(metaPath, b, 0666)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	abs := make([]string, len(paths))
+	for i, p := range paths {
+		abs[i], err = filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	vars := []struct{ name, value string }{
+		{"paths", strings.Join(abs, string(filepath.ListSeparator))},
+		{"hash", meta.Hash},
+		{"buildTime", meta.BuildTime.Format(time.RFC3339)},
+		{"version", Version},
+	}
+
+	var flags []string
+	for _, v := range vars {
+		flags = append(flags, "-X",
+			fmt.Sprintf("%s.%s=%s", scriptInfoPkg, v.name, v.value))
+	}
+	return flags, nil
+}
+
+// withLdflags returns the go build flags with the linker flags ld added.
+//
+// A later -ldflags replaces an earlier one, so ld is given first and is
+// also merged into every -ldflags of flags. There, ld is followed by the
+// linker flags given, which may still override it. The linker flags are
+// parsed, and quoted, as the go tool does.
+func withLdflags(ld []string, flags []string) ([]string, error) {
+	value, err := joinQuoted(ld)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []string{"-ldflags=" + value}
+	for i := 0; i < len(flags); i++ {
+		name, value, hasValue := strings.Cut(flags[i], "=")
+		if name != "-ldflags" && name != "--ldflags" {
+			out = append(out, flags[i])
+			continue
+		}
+		if !hasValue {
+			// The value is the next arg, eg: -ldflags "-s -w"
+			if i+1 == len(flags) {
+				out = append(out, flags[i])
+				continue
+			}
+			i++
+			value = flags[i]
+		}
+
+		merged, err := mergeLdflags(ld, value)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, "-ldflags="+merged)
+	}
+	return out, nil
+}
+
+// mergeLdflags returns the -ldflags value with ld before its linker
+// flags, keeping its package pattern if any. Eg: all=-s
+func mergeLdflags(ld []string, value string) (string, error) {
+	// As with the go tool, a value not starting with a flag starts with
+	// a package pattern.
+	value = strings.TrimSpace(value)
+	var pattern string
+	if value != "" && value[0] != '-' {
+		i := strings.Index(value, "=")
+		if i <= 0 || value[0] == '\'' || value[0] == '"' {
+			return "", fmt.Errorf("Invalid -ldflags value: %q", value)
+		}
+		pattern, value = value[:i+1], value[i+1:]
+	}
+
+	args, err := splitQuoted(value)
+	if err != nil {
+		return "", fmt.Errorf("Invalid -ldflags value: %s", err)
+	}
+	merged, err := joinQuoted(append(append([]string{}, ld...), args...))
+	if err != nil {
+		return "", err
+	}
+	return pattern + merged, nil
+}
+
+// splitQuoted splits s into fields separated by whitespace, as the go
+// tool splits flag values such as -ldflags. A field starting with a
+// single or double quote runs to the matching quote, which may not be
+// escaped.
+func splitQuoted(s string) ([]string, error) {
+	var fields []string
+	for {
+		s = strings.TrimLeft(s, " \t\n\r")
+		if s == "" {
+			return fields, nil
+		}
+		if q := s[0]; q == '"' || q == '\'' {
+			i := strings.IndexByte(s[1:], q)
+			if i < 0 {
+				return nil, fmt.Errorf("unterminated %c string", q)
+			}
+			fields = append(fields, s[1:i+1])
+			s = s[i+2:]
+			continue
+		}
+		i := strings.IndexAny(s, " \t\n\r")
+		if i < 0 {
+			i = len(s)
+		}
+		fields = append(fields, s[:i])
+		s = s[i:]
+	}
+}
+
+// joinQuoted joins args into a value which splitQuoted splits back into
+// args, quoting those which need it. The go tool does not support
+// escapes, so an arg containing both single and double quotes can't be
+// joined.
+func joinQuoted(args []string) (string, error) {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		hasSpace := strings.ContainsAny(arg, " \t\n\r")
+		hasSingle := strings.Contains(arg, "'")
+		hasDouble := strings.Contains(arg, `"`)
+		switch {
+		case !hasSpace && !hasSingle && !hasDouble:
+			quoted[i] = arg
+		case !hasSingle:
+			quoted[i] = "'" + arg + "'"
+		case !hasDouble:
+			quoted[i] = `"` + arg + `"`
+		default:
+			return "", fmt.Errorf("Linker flag %q can't be quoted, as it "+
+				"contains both single and double quotes", arg)
+		}
+	}
+	return strings.Join(quoted, " "), nil
+}
+
+// metadataPath returns the metadata path for the given bin.
+func metadataPath(binDst string) string {
+	return binDst + ".meta"
+}
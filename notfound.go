@@ -0,0 +1,141 @@
+package goscriptify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rejection is why a candidate path was rejected as a script.
+type Rejection int
+
+const (
+	// RejectMissing is a candidate which doesn't exist.
+	RejectMissing Rejection = iota
+
+	// RejectIsDir is a candidate which is a dir, where only a script
+	// was accepted.
+	RejectIsDir
+
+	// RejectPermission is a candidate which couldn't be checked or read,
+	// due to its permissions or those of its parents.
+	RejectPermission
+
+	// RejectExtension is a script in a subdirectory without the .go
+	// extension, which is needed to build its dir. See FindScriptOrDir.
+	RejectExtension
+
+	// RejectError is a candidate which couldn't be checked or read, for
+	// any other reason.
+	RejectError
+)
+
+func (r Rejection) String() string {
+	switch r {
+	case RejectMissing:
+		return "missing"
+	case RejectIsDir:
+		return "is directory"
+	case RejectPermission:
+		return "permission denied"
+	case RejectExtension:
+		return "wrong extension in a subdirectory, must be .go"
+	default:
+		return "error"
+	}
+}
+
+// Candidate is a path which was checked for a script, and rejected.
+type Candidate struct {
+	// Path is the absolute path which was checked.
+	Path string
+
+	// Reason is why the path was rejected.
+	Reason Rejection
+
+	// Err is the underlying error of checking the path, if any.
+	Err error
+}
+
+func (c Candidate) String() string {
+	if c.Reason == RejectError && c.Err != nil {
+		return fmt.Sprintf("%s: %s", c.Path, c.Err)
+	}
+	return fmt.Sprintf("%s: %s", c.Path, c.Reason)
+}
+
+// NotFoundError is returned when none of the given scripts could be
+// found, or a script was found but can't be used. It lists every
+// candidate path checked, in order.
+type NotFoundError struct {
+	// Scripts are the scripts which were searched for.
+	Scripts []string
+
+	// Candidates are the paths checked, and why each was rejected.
+	Candidates []Candidate
+}
+
+func (e *NotFoundError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Cannot find %s", strings.Join(e.Scripts, ", "))
+	if len(e.Candidates) > 0 {
+		b.WriteString(", checked:")
+	}
+	for _, c := range e.Candidates {
+		fmt.Fprintf(&b, "\n  %s", c)
+	}
+	return b.String()
+}
+
+// Unwrap returns the underlying errors of the candidates, allowing them
+// to be matched with errors.Is and errors.As.
+func (e *NotFoundError) Unwrap() []error {
+	var errs []error
+	for _, c := range e.Candidates {
+		if c.Err != nil {
+			errs = append(errs, c.Err)
+		}
+	}
+	return errs
+}
+
+// checkCandidate checks the candidate script p, relative to cwd. It
+// returns the absolute path of p, and whether it's a dir. If p isn't a
+// dir or a readable file, the rejected candidate is returned instead.
+func checkCandidate(cwd, p string) (abs string, isDir bool, rej *Candidate) {
+	abs, err := filepath.Abs(filepath.Join(cwd, p))
+	if err != nil {
+		abs = filepath.Join(cwd, p)
+		return abs, false, rejectCandidate(abs, err)
+	}
+
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return abs, false, rejectCandidate(abs, err)
+	}
+	if fi.IsDir() {
+		return abs, true, nil
+	}
+
+	// A script which can't be read can't be compiled either, so it may as
+	// well not exist.
+	f, err := os.Open(abs)
+	if err != nil {
+		return abs, false, rejectCandidate(abs, err)
+	}
+	f.Close()
+	return abs, false, nil
+}
+
+// rejectCandidate returns the candidate rejected due to err.
+func rejectCandidate(abs string, err error) *Candidate {
+	reason := RejectError
+	switch {
+	case os.IsNotExist(err):
+		reason = RejectMissing
+	case os.IsPermission(err):
+		reason = RejectPermission
+	}
+	return &Candidate{Path: abs, Reason: reason, Err: err}
+}
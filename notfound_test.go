@@ -0,0 +1,115 @@
+package goscriptify
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNotFoundError(t *testing.T) {
+	Convey("Should list every candidate checked", t, func() {
+		root, err := ioutil.TempDir("", "goscriptify-notfound")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(root)
+		root, err = filepath.EvalSymlinks(root)
+		So(err, ShouldBeNil)
+
+		So(makeTree(root,
+			".git/config",
+			"sub/Builder",
+			"tools/build",
+		), ShouldBeNil)
+		sub := filepath.Join(root, "sub")
+
+		Convey("Should reject missing files and dirs", func() {
+			_, _, err := findScriptOrDir(root, []string{"missing", "sub"}, true)
+			So(err, ShouldBeNil)
+
+			_, err = searchScript(root, "", []string{"missing", "sub"},
+				SearchRepoRoot)
+			nf, ok := err.(*NotFoundError)
+			So(ok, ShouldBeTrue)
+			So(nf.Scripts, ShouldResemble, []string{"missing", "sub"})
+			So(len(nf.Candidates), ShouldEqual, 2)
+			So(nf.Candidates[0].Path, ShouldEqual,
+				filepath.Join(root, "missing"))
+			So(nf.Candidates[0].Reason, ShouldEqual, RejectMissing)
+			So(nf.Candidates[1].Path, ShouldEqual, sub)
+			So(nf.Candidates[1].Reason, ShouldEqual, RejectIsDir)
+			So(nf.Candidates[1].Err, ShouldBeNil)
+			So(nf.Error(), ShouldStartWith,
+				"Cannot find missing, sub, checked:")
+		})
+
+		Convey("Should wrap the underlying errors", func() {
+			_, err := searchScript(root, "", []string{"missing"},
+				SearchRepoRoot)
+			So(errors.Is(err, os.ErrNotExist), ShouldBeTrue)
+		})
+
+		Convey("Should reject scripts in subdirs without .go", func() {
+			_, _, err := findScriptOrDir(root,
+				[]string{filepath.Join("tools", "build")}, true)
+			nf, ok := err.(*NotFoundError)
+			So(ok, ShouldBeTrue)
+			So(len(nf.Candidates), ShouldEqual, 1)
+			So(nf.Candidates[0].Path, ShouldEqual,
+				filepath.Join(root, "tools", "build"))
+			So(nf.Candidates[0].Reason, ShouldEqual, RejectExtension)
+		})
+
+		Convey("Should check the next candidate after a missing one", func() {
+			p, isDir, err := findScriptOrDir(root, []string{
+				"missing",
+				filepath.Join("tools", "build"),
+			}, false)
+			So(err, ShouldBeNil)
+			So(isDir, ShouldBeFalse)
+			So(p, ShouldEqual, filepath.Join("tools", "build"))
+		})
+
+		Convey("Should stop at a subdir script without .go", func() {
+			_, _, err := findScriptOrDir(root, []string{
+				"missing",
+				filepath.Join("tools", "build"),
+				"tools",
+			}, true)
+			nf, ok := err.(*NotFoundError)
+			So(ok, ShouldBeTrue)
+			So(len(nf.Candidates), ShouldEqual, 2)
+			So(nf.Candidates[1].Reason, ShouldEqual, RejectExtension)
+
+			_, err = searchScriptOrDir(sub, "",
+				[]string{filepath.Join("tools", "build")}, true, SearchRoot)
+			nf, ok = err.(*NotFoundError)
+			So(ok, ShouldBeTrue)
+			So(len(nf.Candidates), ShouldEqual, 2)
+			So(nf.Candidates[1].Path, ShouldEqual,
+				filepath.Join(root, "tools", "build"))
+			So(nf.Candidates[1].Reason, ShouldEqual, RejectExtension)
+		})
+
+		Convey("Should list the candidates of every dir searched", func() {
+			_, err := searchScript(sub, "", []string{"builder"},
+				SearchRepoRoot)
+			nf, ok := err.(*NotFoundError)
+			So(ok, ShouldBeTrue)
+			So(len(nf.Candidates), ShouldEqual, 2)
+			So(nf.Candidates[0].Path, ShouldEqual,
+				filepath.Join(sub, "builder"))
+			So(nf.Candidates[1].Path, ShouldEqual,
+				filepath.Join(root, "builder"))
+
+			lines := strings.Split(nf.Error(), "\n")
+			So(len(lines), ShouldEqual, 3)
+			So(lines[0], ShouldEqual, "Cannot find builder, checked:")
+			So(lines[1], ShouldEqual,
+				"  "+filepath.Join(sub, "builder")+": missing")
+		})
+	})
+}
@@ -0,0 +1,173 @@
+package goscriptify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/leeola/goscriptify/utils"
+)
+
+// PluginEntry is the name of the function that plugin scripts must
+// export, with the PluginMain signature. Eg:
+//
+//	func Main(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+const PluginEntry = "Main"
+
+// PluginMain is the signature of a plugin script's entry point. The
+// returned int is the exit status of the script.
+type PluginMain func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+
+// ErrPluginUnsupported is returned when running plugins on a platform
+// which does not support them.
+var ErrPluginUnsupported = errors.New("Plugins are only supported on " +
+	"Linux, with cgo enabled")
+
+// RunPluginWithOpts copies and compiles the given scripts as a Go plugin,
+// and then calls its Main function in this process, with the given
+// options.
+//
+// This avoids starting a process for each run of the script, at the cost
+// of isolation. The script shares this process, and is never unloaded.
+func RunPluginWithOpts(scripts, args []string,
+	opts ScriptOptions) (int, error) {
+	return RunPluginContext(context.Background(), scripts, args, opts)
+}
+
+// RunPluginContext is RunPluginWithOpts, stopping the build if ctx is
+// done (or opts.Timeout passes) before it completes. Once the plugin is
+// running, it cannot be stopped.
+func RunPluginContext(ctx context.Context, scripts, args []string,
+	opts ScriptOptions) (int, error) {
+	if opts.Sandbox != nil {
+		return 0, ErrSandboxUnsupported
+	}
+
+	// Coverage is written when a process exits, so plugins can't collect
+	// it.
+	opts.CoverDir = ""
+
+	ctx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	c, err := compileScripts(ctx, scripts, opts, compilePlugin)
+	if err != nil {
+		return 0, err
+	}
+
+	return runPlugin(c.Bin, args, opts)
+}
+
+// RunPluginDirWithOpts compiles the given go package directory as a Go
+// plugin, and then calls its Main function in this process, with the
+// given options.
+func RunPluginDirWithOpts(dir string, args []string,
+	opts ScriptOptions) (int, error) {
+	return RunPluginDirContext(context.Background(), dir, args, opts)
+}
+
+// RunPluginDirContext is RunPluginDirWithOpts, stopping the build if ctx
+// is done (or opts.Timeout passes) before it completes. Once the plugin
+// is running, it cannot be stopped.
+func RunPluginDirContext(ctx context.Context, dir string, args []string,
+	opts ScriptOptions) (int, error) {
+	if opts.Sandbox != nil {
+		return 0, ErrSandboxUnsupported
+	}
+
+	// Coverage is written when a process exits, so plugins can't collect
+	// it.
+	opts.CoverDir = ""
+
+	ctx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	c, err := compileDir(ctx, dir, opts, compilePlugin)
+	if err != nil {
+		return 0, err
+	}
+
+	return runPlugin(c.Bin, args, opts)
+}
+
+// pluginToolchain selects the toolchain for the given plugin sources.
+// Plugins must be built by the same Go version as this process, so the
+// toolchain matching it is selected, if it satisfies the sources.
+func pluginToolchain(srcs []string, opts ScriptOptions) (Toolchain, error) {
+	min, err := ParseGoDirective(srcs)
+	if err != nil {
+		return Toolchain{}, err
+	}
+
+	want := runtime.Version()
+	if min != "" && compareGoVersions(want, min) < 0 {
+		return Toolchain{}, fmt.Errorf("Script requires go %s, but plugins "+
+			"must be built with %s, the Go version of this process", min, want)
+	}
+
+	found := findToolchains(opts.SDKDirs, toolchainCachePath(opts.Temp))
+	for _, tc := range found {
+		if tc.Version == want {
+			return tc, nil
+		}
+	}
+
+	versions := make([]string, len(found))
+	for i, tc := range found {
+		versions[i] = fmt.Sprintf("\t%s (%s)", tc.Version, tc.Go)
+	}
+	return Toolchain{}, fmt.Errorf("Plugins must be built with %s, the Go "+
+		"version of this process, but only found:\n%s", want,
+		strings.Join(versions, "\n"))
+}
+
+// hostBuildFlags are the build settings of this process which are go
+// build flags, and must be matched by plugins.
+var hostBuildFlags = map[string]bool{
+	"-asan": true, "-msan": true, "-race": true, "-trimpath": true,
+	"-tags": true, "-gcflags": true,
+}
+
+// hostBuildSettings returns the go build flags, and environment, which
+// build a plugin the same way as this process. Plugins are rejected
+// when loaded if any package they share with the process was built
+// differently, such as with -race.
+func hostBuildSettings() (flags, env []string) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil, nil
+	}
+
+	for _, s := range info.Settings {
+		switch {
+		case hostBuildFlags[s.Key]:
+			if s.Value == "false" {
+				continue
+			}
+			if s.Value == "true" {
+				flags = append(flags, s.Key)
+			} else {
+				flags = append(flags, s.Key+"="+s.Value)
+			}
+		case s.Key == "CGO_ENABLED" || strings.HasPrefix(s.Key, "GO"):
+			env = append(env, s.Key+"="+s.Value)
+		}
+	}
+	return flags, env
+}
+
+// pluginPath returns the plugin path for the given bin and sources.
+//
+// A plugin can only be loaded once per process, so the path includes
+// the source hash to give changed sources a new plugin.
+func pluginPath(binDst string, srcs []string) (string, error) {
+	h, err := utils.HashFiles(srcs)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s.so", binDst, h), nil
+}
@@ -0,0 +1,47 @@
+//go:build linux && cgo
+// +build linux,cgo
+
+package goscriptify
+
+import (
+	"fmt"
+	"io"
+	"plugin"
+)
+
+// runPlugin opens the plugin at p, and calls its entry point with the
+// given args and the stdin/out/err of opts.
+//
+// If the entry point panics, the panic is returned as an error with the
+// exit status of 2, as a panicking Go program would exit with.
+func runPlugin(p string, args []string, opts ScriptOptions) (exit int,
+	err error) {
+	plug, err := plugin.Open(p)
+	if err != nil {
+		return 0, err
+	}
+
+	sym, err := plug.Lookup(PluginEntry)
+	if err != nil {
+		return 0, err
+	}
+
+	var main PluginMain
+	switch f := sym.(type) {
+	case func([]string, io.Reader, io.Writer, io.Writer) int:
+		main = f
+	case *PluginMain:
+		main = *f
+	default:
+		return 0, fmt.Errorf("Plugin %s has type %T, but must be a %T",
+			PluginEntry, sym, main)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			exit, err = 2, fmt.Errorf("Plugin panic: %v", r)
+		}
+	}()
+
+	return main(args, opts.Stdin, opts.Stdout, opts.Stderr), nil
+}
@@ -0,0 +1,51 @@
+//go:build linux && cgo
+// +build linux,cgo
+
+package goscriptify
+
+import (
+	"bytes"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRunPluginWithOpts(t *testing.T) {
+	fixDir := filepath.Join("_test", "fixtures")
+	tmpDir := filepath.Join("_test", "tmp")
+
+	Convey("Should run the plugin Main in process", t, func() {
+		var stdout, stderr bytes.Buffer
+		exit, err := RunPluginWithOpts([]string{
+			filepath.Join(fixDir, "plugin.go"),
+		}, []string{}, ScriptOptions{
+			Temp:  tmpDir,
+			Stdin: nil, Stdout: &stdout, Stderr: &stderr,
+		})
+		So(err, ShouldBeNil)
+		So(exit, ShouldEqual, 15)
+		So(stdout.String(), ShouldEqual, "STDOUT: Exiting 15")
+		So(stderr.String(), ShouldEqual, "STDERR: Exiting 15")
+	})
+
+	Convey("Should return build error information", t, func() {
+		_, err := RunPluginWithOpts([]string{
+			filepath.Join(fixDir, "synerr.go"),
+		}, []string{}, ScriptOptions{
+			Temp:  tmpDir,
+			Stdin: nil, Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{},
+		})
+		_, ok := err.(*BuildError)
+		So(ok, ShouldBeTrue)
+	})
+}
+
+func TestHostBuildSettings(t *testing.T) {
+	Convey("Should build plugins the same way as this process", t, func() {
+		_, env := hostBuildSettings()
+		So(env, ShouldContain, "CGO_ENABLED=1")
+		So(env, ShouldContain, "GOOS="+runtime.GOOS)
+	})
+}
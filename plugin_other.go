@@ -0,0 +1,10 @@
+//go:build !linux || !cgo
+// +build !linux !cgo
+
+package goscriptify
+
+// runPlugin returns ErrPluginUnsupported, as plugins are unsupported
+// on this platform.
+func runPlugin(p string, args []string, opts ScriptOptions) (int, error) {
+	return 0, ErrPluginUnsupported
+}
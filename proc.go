@@ -1,66 +1,113 @@
 package goscriptify
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 // RunScript copies, compiles, and runs the given script with global
 // $args, and default options - then Exits the process.
 //
+// Catchable signals received while the script runs are forwarded to it,
+// and the process exits once the script has. Received while compiling,
+// they stop the build first.
+//
 // IMPORTANT: This exits the process, captures Stdin, and prints to
 // Stdout and Stderr as needed.
 func RunScript(p string) {
 	opts := NewScriptOptions()
-	exit, err := RunScriptsWithOpts([]string{p}, os.Args[1:], opts)
-	if err != nil {
-		if builderr, ok := err.(*BuildError); ok {
-			fmt.Fprint(os.Stderr, builderr.Error())
-		} else {
-			fmt.Fprintf(os.Stderr, "Fatal: %s", err.Error())
-		}
-
-		if exit == 0 {
-			os.Exit(1)
-		}
-	}
-	os.Exit(exit)
+	exitWith(runWrapped(opts, func(ctx context.Context) (*compiled, error) {
+		return compileScripts(ctx, []string{p}, opts, compileExec)
+	}))
 }
 
 // RunDir compiles and runs the given go package directory with global
 // $args and default options - then Exits the process.
 //
+// Catchable signals received while the script runs are forwarded to it,
+// and the process exits once the script has. Received while compiling,
+// they stop the build first.
+//
 // IMPORTANT: This exits the process, captures Stdin, and prints to
 // Stdout and Stderr as needed.
 func RunDir(p string) {
 	opts := NewScriptOptions()
-	exit, err := RunScriptDirWithOpts(p, os.Args[1:], opts)
-	if err != nil {
-		if builderr, ok := err.(*BuildError); ok {
-			fmt.Fprint(os.Stderr, builderr.Error())
-		} else {
-			fmt.Fprintf(os.Stderr, "Fatal: %s", err.Error())
-		}
+	exitWith(runWrapped(opts, func(ctx context.Context) (*compiled, error) {
+		return compileDir(ctx, p, opts, compileExec)
+	}))
+}
 
-		if exit == 0 {
-			os.Exit(1)
-		}
+// ExecScript copies and compiles the given script, and then replaces
+// the process with it, passing the global $args and default options.
+// The script keeps the PID, terminal and signals of the process. Where
+// replacing the process is unsupported, this behaves as RunScript.
+//
+// IMPORTANT: This replaces, or exits, the process.
+func ExecScript(p string) {
+	opts := NewScriptOptions()
+	execWrapped(func(ctx context.Context) error {
+		return ExecScriptsContext(ctx, []string{p}, os.Args[1:], opts)
+	})
+	RunScript(p)
+}
+
+// ExecDir compiles the given go package directory, and then replaces
+// the process with it, passing the global $args and default options.
+// The script keeps the PID, terminal and signals of the process. Where
+// replacing the process is unsupported, this behaves as RunDir.
+//
+// IMPORTANT: This replaces, or exits, the process.
+func ExecDir(p string) {
+	opts := NewScriptOptions()
+	execWrapped(func(ctx context.Context) error {
+		return ExecScriptDirContext(ctx, p, os.Args[1:], opts)
+	})
+	RunDir(p)
+}
+
+// RunCommand compiles and runs the named main package within the root
+// directory, with global $args and default options - then Exits the
+// process. See FindCommand for how commands are named.
+//
+// Catchable signals received while the command runs are forwarded to
+// it, and the process exits once the command has. Received while
+// compiling, they stop the build first.
+//
+// IMPORTANT: This exits the process, captures Stdin, and prints to
+// Stdout and Stderr as needed.
+func RunCommand(root, name string) {
+	opts := NewScriptOptions()
+	dir, err := FindCommand(root, name)
+	if err != nil {
+		exitWith(nil, err)
 	}
-	os.Exit(exit)
+	exitWith(runWrapped(opts, func(ctx context.Context) (*compiled, error) {
+		return compileDir(ctx, dir, opts, compileExec)
+	}))
 }
 
 // RunOneScript will run the first given script that is found. Basically
-// a shorthand for FindScript and RunScript
+// a shorthand for SearchScript and RunScript.
+//
+// The working directory, and then its parents up to the root of the
+// repository, are searched. The script is run in the directory it was
+// found in, so that it behaves the same from any subdirectory.
+//
+// If no script is found, every path checked is printed along with why
+// it was rejected, and the process exits with 1.
 //
 // IMPORTANT: This exits the process, captures Stdin, and prints to
 // Stdout and Stderr as needed.
 func RunOneScript(scripts ...string) {
-	s, err := FindScript(scripts)
+	f, err := SearchScript(scripts, SearchRepoRoot)
 	if err != nil {
-		log.Fatal("Fatal:", err.Error())
+		exitWith(nil, err)
 	}
-	RunScript(s)
+	runFound(f)
 }
 
 // RunOneScriptOrDir will run the first given script, or directory,
@@ -75,14 +122,138 @@ func RunOneScript(scripts ...string) {
 // IMPORTANT: This exits the process, captures Stdin, and prints to
 // Stdout and Stderr as needed.
 func RunOneScriptOrDir(useDir bool, paths ...string) {
-	s, isDir, err := FindScriptOrDir(paths, useDir)
+	f, err := SearchScriptOrDir(paths, useDir, SearchRepoRoot)
 	if err != nil {
-		log.Fatal("Fatal:", err.Error())
+		exitWith(nil, err)
 	}
+	runFound(f)
+}
+
+// runFound runs the found script, or dir, in the directory it was found
+// in, with global $args and default options - then Exits the process.
+func runFound(f *FoundScript) {
+	opts := NewScriptOptions()
+	opts.Dir = f.Dir
+	exitWith(runWrapped(opts, func(ctx context.Context) (*compiled, error) {
+		if f.IsDir {
+			return compileDir(ctx, f.Path, opts, compileExec)
+		}
+		return compileScripts(ctx, []string{f.Path}, opts, compileExec)
+	}))
+}
+
+// runWrapped compiles, and then runs, the script of a process wrapper
+// with global $args.
+//
+// The script is left in our process group, sharing our terminal. Signals
+// received while compiling stop the build, and are reported as having
+// terminated the script, so that we never exit while the go tool is
+// still running. Once the script starts, they're forwarded to it.
+func runWrapped(opts ScriptOptions,
+	compile func(context.Context) (*compiled, error)) (*RunResult, error) {
+	opts.ForwardSignals = true
+
+	ctx, cancel := withTimeout(withoutGroup(context.Background()),
+		opts.Timeout)
+	defer cancel()
+
+	buildCtx, built, stop := stopBuildOnSignal(ctx)
+	defer stop()
+
+	c, err := compile(buildCtx)
+	if sig := built(); sig != 0 {
+		return &RunResult{ExitCode: -1, Signal: sig}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return runExec(ctx, c, os.Args[1:], opts)
+}
+
+// execWrapped compiles, and then replaces the process with, the script
+// of a process wrapper. Signals received while compiling stop the build,
+// as with runWrapped. It only returns if replacing the process is
+// unsupported.
+func execWrapped(run func(context.Context) error) {
+	buildCtx, built, stop := stopBuildOnSignal(
+		withoutGroup(context.Background()))
+	err := run(buildCtx)
+	sig := built()
+	stop()
+
+	switch {
+	case sig != 0:
+		exitWith(&RunResult{ExitCode: -1, Signal: sig}, nil)
+	case err != ErrExecUnsupported:
+		exitWith(nil, err)
+	}
+}
 
-	if isDir {
-		RunDir(s)
-	} else {
-		RunScript(s)
+// stopBuildOnSignal returns a child context of ctx, which is cancelled
+// by any forwarded signal received while building. Until stop is called,
+// the signals no longer terminate this process.
+//
+// built is called once the build is done, after which signals are left
+// to be forwarded to the script. It returns the signal which cancelled
+// the build, if any.
+func stopBuildOnSignal(ctx context.Context) (_ context.Context,
+	built func() syscall.Signal, stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	if len(forwardedSignals) == 0 {
+		return ctx, func() syscall.Signal { return 0 }, cancel
+	}
+
+	var mu sync.Mutex
+	building := true
+	var received syscall.Signal
+
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, forwardedSignals...)
+
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				mu.Lock()
+				if building && received == 0 {
+					received = sig.(syscall.Signal)
+					cancel()
+				}
+				mu.Unlock()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	built = func() syscall.Signal {
+		mu.Lock()
+		defer mu.Unlock()
+		building = false
+		return received
+	}
+	stop = func() {
+		signal.Stop(sigs)
+		close(done)
+		cancel()
+	}
+	return ctx, built, stop
+}
+
+// exitWith prints any error, and then exits the process with the status
+// of the result. Scripts terminated by signal N exit with 128+N, as they
+// would if run directly by a shell.
+func exitWith(res *RunResult, err error) {
+	if err != nil {
+		if builderr, ok := err.(*BuildError); ok {
+			fmt.Fprint(os.Stderr, builderr.Error())
+		} else if notfound, ok := err.(*NotFoundError); ok {
+			fmt.Fprintln(os.Stderr, notfound.Error())
+		} else {
+			fmt.Fprintf(os.Stderr, "Fatal: %s", err.Error())
+		}
+		os.Exit(1)
 	}
+	os.Exit(res.Status())
 }
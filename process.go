@@ -0,0 +1,290 @@
+package goscriptify
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// Process is a running script, started by StartScripts, StartScriptDir
+// or StartExec.
+type Process struct {
+	// Stdin, Stdout and Stderr are pipes to the script, for each of the
+	// ScriptOptions streams left nil. The others are nil.
+	//
+	// Stdout and Stderr reach EOF once the script, and any children
+	// sharing them, exit. Close Stdin to send EOF to the script.
+	Stdin  io.WriteCloser
+	Stdout io.ReadCloser
+	Stderr io.ReadCloser
+
+	cmd  *exec.Cmd
+	pty  *pty
+	done chan struct{}
+	res  *RunResult
+	err  error
+}
+
+// StartScripts copies and compiles the given scripts, and then starts
+// the script without waiting for it to exit. See RunScriptsContext.
+//
+// The script is stopped if ctx is done (or opts.Timeout passes) before
+// it exits, as with RunScriptsContext. The Wait method returns how it
+// exited.
+func StartScripts(ctx context.Context, scripts, args []string,
+	opts ScriptOptions) (*Process, error) {
+	return startScripts(ctx, scripts, args, opts, true)
+}
+
+// startScripts is StartScripts, only piping the stdio of opts if pipes
+// is true.
+func startScripts(ctx context.Context, scripts, args []string,
+	opts ScriptOptions, pipes bool) (*Process, error) {
+	ctx, cancel := withTimeout(ctx, opts.Timeout)
+
+	c, err := compileScripts(ctx, scripts, opts, compileExec)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return startProcess(ctx, cancel, c, args, opts, pipes)
+}
+
+// StartScriptDir compiles the given go package directory, and then
+// starts the script without waiting for it to exit. See StartScripts.
+func StartScriptDir(ctx context.Context, dir string, args []string,
+	opts ScriptOptions) (*Process, error) {
+	return startScriptDir(ctx, dir, args, opts, true)
+}
+
+// startScriptDir is StartScriptDir, only piping the stdio of opts if
+// pipes is true.
+func startScriptDir(ctx context.Context, dir string, args []string,
+	opts ScriptOptions, pipes bool) (*Process, error) {
+	ctx, cancel := withTimeout(ctx, opts.Timeout)
+
+	c, err := compileDir(ctx, dir, opts, compileExec)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return startProcess(ctx, cancel, c, args, opts, pipes)
+}
+
+// StartExec starts the given path as an executable, without waiting for
+// it to exit. See RunExecContext.
+func StartExec(ctx context.Context, p string, args []string,
+	opts ScriptOptions) (*Process, error) {
+	ctx, cancel := withTimeout(ctx, opts.Timeout)
+	c := &compiled{Bin: p, Script: p, Dir: filepath.Dir(p)}
+	return startProcess(ctx, cancel, c, args, opts, true)
+}
+
+// PID returns the process id of the script.
+func (p *Process) PID() int {
+	return p.cmd.Process.Pid
+}
+
+// Signal sends sig to the script. Once the script has exited,
+// os.ErrProcessDone is returned.
+func (p *Process) Signal(sig os.Signal) error {
+	return p.cmd.Process.Signal(sig)
+}
+
+// Done returns a channel which is closed once the script has exited,
+// and Wait will no longer block.
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait waits for the script to exit, and returns how it exited. As with
+// RunScriptsContext a non-zero exit is reported by the RunResult, not as
+// an error. Wait may be called any number of times.
+func (p *Process) Wait() (*RunResult, error) {
+	<-p.done
+	return p.res, p.err
+}
+
+// startProcess starts the compiled script, and waits for it to exit in
+// the background. The cancel func, if non-nil, is called once it has.
+//
+// If pipes is true, any nil stdio stream of opts is replaced by a pipe
+// to the script, available from the returned Process.
+func startProcess(ctx context.Context, cancel context.CancelFunc,
+	c *compiled, args []string, opts ScriptOptions,
+	pipes bool) (proc *Process, err error) {
+	if cancel != nil {
+		defer func() {
+			if err != nil {
+				cancel()
+			}
+		}()
+	}
+
+	// The bin is made absolute, as a relative path would otherwise be
+	// resolved from the working directory of the script.
+	bin, err := filepath.Abs(c.Bin)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(bin); err != nil {
+		return nil, err
+	}
+
+	dir, err := opts.workDir(c.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := opts.environ(c)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(bin, args...)
+	cmd.Env = env
+	cmd.Dir = dir
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+
+	if opts.Sandbox != nil {
+		if err := sandboxCmd(ctx, cmd, opts.Sandbox, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	proc = &Process{cmd: cmd, done: make(chan struct{})}
+
+	// The ends of the pipes given to the script are closed once it's
+	// started, and ours only if it fails to start.
+	var ours, theirs []*os.File
+	defer func() {
+		closeFiles(theirs)
+		if err != nil {
+			closeFiles(ours)
+		}
+	}()
+	if opts.PTY {
+		proc.pty, err = startPTY(cmd, opts, proc, pipes)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err != nil {
+				proc.pty.close()
+			}
+		}()
+	} else if pipes {
+		ours, theirs, err = proc.pipeStdio(cmd, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	lim, err := startLimited(ctx, cmd, opts, func() error {
+		return startCmd(ctx, cmd, newGroup(ctx))
+	})
+	if err != nil {
+		if err == ctx.Err() {
+			return nil, ctxError(ctx, "run")
+		}
+		if opts.Sandbox != nil {
+			return nil, sandboxStartError(cmd, err)
+		}
+		return nil, err
+	}
+
+	stop := func() {}
+	if opts.ForwardSignals {
+		stop = forwardSignals(cmd)
+	}
+	if proc.pty != nil {
+		proc.pty.started()
+	}
+
+	go func() {
+		defer close(proc.done)
+		if cancel != nil {
+			defer cancel()
+		}
+
+		err := waitCmd(ctx, cmd, opts.GracePeriod)
+		stop()
+		if proc.pty != nil {
+			proc.pty.wait()
+		}
+		proc.res, proc.err = exitResult(ctx, cmd, err)
+		lim.check(proc.res, ctx.Err() != nil)
+		lim.release()
+		if proc.res != nil {
+			proc.res.WallTime = time.Since(start)
+			proc.res.Bin = bin
+			proc.res.Cached = c.Cached
+			proc.res.BuildTime = c.BuildTime
+		}
+	}()
+
+	return proc, nil
+}
+
+// pipeStdio replaces each nil stdio stream of opts with a pipe to the
+// cmd. The ends of the pipes for the Process, and for the cmd, are
+// returned, even if an error is.
+func (p *Process) pipeStdio(cmd *exec.Cmd, opts ScriptOptions) (ours,
+	theirs []*os.File, err error) {
+	if opts.Stdin == nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return ours, theirs, err
+		}
+		cmd.Stdin, p.Stdin = r, w
+		ours, theirs = append(ours, w), append(theirs, r)
+	}
+	if opts.Stdout == nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return ours, theirs, err
+		}
+		cmd.Stdout, p.Stdout = w, r
+		ours, theirs = append(ours, r), append(theirs, w)
+	}
+	if opts.Stderr == nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return ours, theirs, err
+		}
+		cmd.Stderr, p.Stderr = w, r
+		ours, theirs = append(ours, r), append(theirs, w)
+	}
+	return ours, theirs, nil
+}
+
+// exitResult returns the RunResult of the exited cmd, given the error
+// from waiting on it.
+func exitResult(ctx context.Context, cmd *exec.Cmd,
+	err error) (*RunResult, error) {
+	if err != nil && err == ctx.Err() {
+		return nil, ctxError(ctx, "run")
+	}
+	if err != nil {
+		// A non-zero exit is reported by the result, not as an error.
+		if _, ok := err.(*exec.ExitError); !ok {
+			return nil, err
+		}
+	}
+	return resultOf(cmd.ProcessState), nil
+}
+
+// closeFiles closes each of the given files.
+func closeFiles(fs []*os.File) {
+	for _, f := range fs {
+		f.Close()
+	}
+}
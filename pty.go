@@ -0,0 +1,302 @@
+package goscriptify
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ErrPTYUnsupported is returned when ScriptOptions.PTY is set on a
+// platform that cannot allocate pseudo-terminals.
+var ErrPTYUnsupported = errors.New("Pseudo-terminals are only supported " +
+	"on Linux")
+
+// The size of a pseudo-terminal, when there's no terminal of ours to
+// take the size from.
+const (
+	DefaultPTYRows = 24
+	DefaultPTYCols = 80
+)
+
+// ptyDrain is how long the output of a pseudo-terminal is read for after
+// the script exits, while children it left running still hold it open.
+const ptyDrain = time.Second
+
+// ptyPoll is how often a file copied to a pseudo-terminal is checked for
+// the script having exited, while there's nothing to read from it.
+const ptyPoll = 50 * time.Millisecond
+
+// pty is the pseudo-terminal of a script. The script's stdio is the
+// slave, while we copy between the master and the ScriptOptions stdio.
+type pty struct {
+	master, slave *os.File
+
+	// in and out are copied to and from the master.
+	in  io.Reader
+	out io.Writer
+
+	// outPipe is the pipe end of Process.Stdout, closed once all output
+	// is copied.
+	outPipe *os.File
+
+	// term is our own terminal, whose size the pty follows.
+	term *os.File
+
+	// rawIn is our stdin terminal, which is put into raw mode.
+	rawIn *os.File
+
+	restore    func()
+	stopResize func()
+	output     chan struct{}
+
+	// exited is closed once the script exits, stopping the copy of in.
+	// input is closed once the copy stops, if in is a file.
+	exited chan struct{}
+	input  chan struct{}
+}
+
+// startPTY allocates a pseudo-terminal for the cmd, and makes it the
+// controlling terminal of the cmd's new session. If pipes is true, any
+// nil stdin or stdout of opts is replaced by a pipe to the pty,
+// available from proc.
+//
+// Stderr is ignored, as the script writes it to the pty with stdout.
+func startPTY(cmd *exec.Cmd, opts ScriptOptions, proc *Process,
+	pipes bool) (*pty, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pty{
+		master: master, slave: slave,
+		in: opts.Stdin, out: opts.Stdout,
+		restore: func() {}, stopResize: func() {},
+		output: make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+
+	if f := terminalOf(opts.Stdin); f != nil {
+		p.term, p.rawIn = f, f
+	} else if f := terminalOf(opts.Stdout); f != nil {
+		p.term = f
+	}
+
+	rows, cols := DefaultPTYRows, DefaultPTYCols
+	if p.term != nil {
+		rows, cols, _ = getWinsize(p.term)
+	}
+	if err := setWinsize(master, rows, cols); err != nil {
+		p.close()
+		return nil, err
+	}
+
+	if pipes && opts.Stdin == nil {
+		proc.Stdin = &ptyInput{master: master}
+	}
+	if pipes && opts.Stdout == nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			p.close()
+			return nil, err
+		}
+		proc.Stdout, p.out, p.outPipe = r, w, w
+	}
+	if p.out == nil {
+		p.out = io.Discard
+	}
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	setControllingTTY(cmd)
+	return p, nil
+}
+
+// terminalOf returns the stream as a file, if it's a terminal.
+func terminalOf(stream interface{}) *os.File {
+	f, ok := stream.(*os.File)
+	if !ok {
+		return nil
+	}
+	if _, _, err := getWinsize(f); err != nil {
+		return nil
+	}
+	return f
+}
+
+// started begins copying to and from the pty, once the cmd has started
+// with its slave.
+func (p *pty) started() {
+	p.slave.Close()
+
+	if p.rawIn != nil {
+		if restore, err := makeRaw(p.rawIn); err == nil {
+			p.restore = restore
+		}
+	}
+
+	if p.term != nil {
+		resized := make(chan os.Signal, 1)
+		done := make(chan struct{})
+		stop := notifyResize(resized)
+		p.stopResize = func() {
+			stop()
+			close(done)
+		}
+
+		go func() {
+			for {
+				select {
+				case <-resized:
+					if rows, cols, err := getWinsize(p.term); err == nil {
+						setWinsize(p.master, rows, cols)
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(p.output)
+		// Reading fails with EIO once the slave is closed by the script.
+		io.Copy(p.out, p.master)
+		if p.outPipe != nil {
+			p.outPipe.Close()
+		}
+	}()
+
+	if p.in != nil {
+		if _, ok := p.in.(*os.File); ok {
+			p.input = make(chan struct{})
+		}
+		go p.copyInput()
+	}
+}
+
+// copyInput copies in to the master, until in ends or the script exits.
+//
+// A file, such as our terminal, is polled rather than blocked on so that
+// it's not read once the script exits, and the copy stops with it. Other
+// readers can't be interrupted, and may be read once more.
+func (p *pty) copyInput() {
+	if p.input != nil {
+		defer close(p.input)
+	}
+
+	var err error
+	if f, ok := p.in.(*os.File); ok {
+		err = p.copyFile(f)
+	} else {
+		_, err = io.Copy(p.master, p.in)
+	}
+
+	// Send EOF for a finite stdin, such as a buffer.
+	if err != errExited && p.in != p.rawIn {
+		p.master.Write([]byte{eot})
+	}
+}
+
+// errExited stops the copy of input to a script which has exited.
+var errExited = errors.New("goscriptify: script exited")
+
+// copyFile copies f to the master, only reading f once it's readable so
+// that the copy can stop when the script exits.
+func (p *pty) copyFile(f *os.File) error {
+	buf := make([]byte, 32*1024)
+	for {
+		ready, err := waitReadable(f, ptyPoll)
+		if err != nil {
+			return err
+		}
+		select {
+		case <-p.exited:
+			return errExited
+		default:
+		}
+		if !ready {
+			continue
+		}
+
+		n, err := f.Read(buf)
+		if n > 0 {
+			if _, err := p.master.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// wait stops copying input to the exited script, finishes copying its
+// output, and restores our terminal.
+func (p *pty) wait() {
+	close(p.exited)
+	if p.input != nil {
+		<-p.input
+	}
+	p.stopResize()
+	p.restore()
+
+	select {
+	case <-p.output:
+	case <-time.After(ptyDrain):
+	}
+	p.master.Close()
+	<-p.output
+}
+
+// close releases the pty of a cmd which failed to start.
+func (p *pty) close() {
+	p.master.Close()
+	p.slave.Close()
+	if p.outPipe != nil {
+		p.outPipe.Close()
+	}
+}
+
+// resize sets the window size of the pty.
+func (p *pty) resize(rows, cols int) error {
+	return setWinsize(p.master, rows, cols)
+}
+
+// eot is the end of transmission character, which a terminal in
+// canonical mode reads as EOF.
+const eot = 0x04
+
+// ptyInput is the Process.Stdin of a pty, which sends EOF to the script
+// when closed.
+type ptyInput struct {
+	master *os.File
+	once   sync.Once
+}
+
+func (i *ptyInput) Write(b []byte) (int, error) {
+	return i.master.Write(b)
+}
+
+func (i *ptyInput) Close() error {
+	var err error
+	i.once.Do(func() {
+		_, err = i.master.Write([]byte{eot})
+	})
+	return err
+}
+
+// errNoPTY is returned when resizing a Process without a pty.
+var errNoPTY = errors.New("goscriptify: script has no pseudo-terminal")
+
+// Resize sets the window size of the script's pseudo-terminal, which the
+// script is notified of by SIGWINCH. It's only valid with
+// ScriptOptions.PTY.
+func (p *Process) Resize(rows, cols int) error {
+	if p.pty == nil {
+		return errNoPTY
+	}
+	return p.pty.resize(rows, cols)
+}
@@ -0,0 +1,162 @@
+package goscriptify
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// winsize is the struct winsize of the TIOCGWINSZ and TIOCSWINSZ
+// ioctls.
+type winsize struct {
+	Rows, Cols, X, Y uint16
+}
+
+// openPTY allocates a pseudo-terminal, returning its master and slave.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var n uint32
+	var unlock int32
+	err = ioctl(master.Fd(), syscall.TIOCSPTLCK, unsafe.Pointer(&unlock))
+	if err == nil {
+		err = ioctl(master.Fd(), syscall.TIOCGPTN, unsafe.Pointer(&n))
+	}
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n),
+		os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	return master, slave, nil
+}
+
+// setControllingTTY starts the cmd in a new session, with its stdin as
+// the controlling terminal.
+func setControllingTTY(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+}
+
+// getWinsize returns the window size of the terminal f.
+func getWinsize(f *os.File) (rows, cols int, err error) {
+	var ws winsize
+	err = ioctl(f.Fd(), syscall.TIOCGWINSZ, unsafe.Pointer(&ws))
+	return int(ws.Rows), int(ws.Cols), err
+}
+
+// setWinsize sets the window size of the terminal f.
+func setWinsize(f *os.File, rows, cols int) error {
+	ws := winsize{Rows: uint16(rows), Cols: uint16(cols)}
+	return ioctl(f.Fd(), syscall.TIOCSWINSZ, unsafe.Pointer(&ws))
+}
+
+// makeRaw puts the terminal f into raw mode, so that input is passed
+// through as typed. The returned func restores its previous mode.
+func makeRaw(f *os.File) (restore func(), err error) {
+	var old syscall.Termios
+	err = ioctl(f.Fd(), syscall.TCGETS, unsafe.Pointer(&old))
+	if err != nil {
+		return nil, err
+	}
+
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK |
+		syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL |
+		syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON |
+		syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	err = ioctl(f.Fd(), syscall.TCSETS, unsafe.Pointer(&raw))
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ioctl(f.Fd(), syscall.TCSETS, unsafe.Pointer(&old))
+	}, nil
+}
+
+// notifyResize relays window size changes of our terminal to c, until
+// the returned func is called.
+func notifyResize(c chan<- os.Signal) (stop func()) {
+	signal.Notify(c, syscall.SIGWINCH)
+	return func() {
+		signal.Stop(c)
+	}
+}
+
+// pollfd is the struct pollfd of ppoll.
+type pollfd struct {
+	fd      int32
+	events  int16
+	revents int16
+}
+
+// The poll events of pollfd.
+const (
+	pollIn   = 0x1
+	pollNval = 0x20
+)
+
+// waitReadable waits up to timeout for f to be readable, returning
+// whether it is. A file which has hung up, or is at EOF, is readable.
+func waitReadable(f *os.File, timeout time.Duration) (bool, error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return false, err
+	}
+
+	var ready bool
+	var pollErr error
+	err = rc.Control(func(fd uintptr) {
+		pfd := pollfd{fd: int32(fd), events: pollIn}
+		ts := syscall.NsecToTimespec(int64(timeout))
+		n, _, errno := syscall.Syscall6(syscall.SYS_PPOLL,
+			uintptr(unsafe.Pointer(&pfd)), 1, uintptr(unsafe.Pointer(&ts)),
+			0, 0, 0)
+		switch {
+		case errno == syscall.EINTR:
+		case errno != 0:
+			pollErr = errno
+		case pfd.revents&pollNval != 0:
+			pollErr = os.ErrClosed
+		default:
+			ready = n > 0
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+	return ready, pollErr
+}
+
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
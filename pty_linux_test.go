@@ -0,0 +1,94 @@
+package goscriptify
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPTY(t *testing.T) {
+	e := filepath.Join("_test", "fixtures", "tty.bash")
+
+	Convey("Should run the script in a pseudo-terminal", t, func() {
+		var stdout bytes.Buffer
+		res, err := RunExecContext(context.Background(), e, []string{},
+			ScriptOptions{
+				Stdin: strings.NewReader("foo\n"), Stdout: &stdout,
+				PTY: true,
+			})
+		So(err, ShouldBeNil)
+		So(res.ExitCode, ShouldEqual, 0)
+
+		// The terminal translates newlines, and echoes the input.
+		out := strings.Replace(stdout.String(), "\r\n", "\n", -1)
+		So(out, ShouldContainSubstring, "is a tty\n")
+		So(out, ShouldContainSubstring, "got foo\n")
+		So(out, ShouldEndWith, "24 80\n")
+	})
+
+	Convey("Should stop reading a file Stdin once the script exits", t,
+		func() {
+			r, w, err := os.Pipe()
+			So(err, ShouldBeNil)
+			defer r.Close()
+			defer w.Close()
+
+			res, err := RunExecContext(context.Background(),
+				filepath.Join("_test", "fixtures", "exitarg.bash"),
+				[]string{"0"}, ScriptOptions{
+					Stdin: r, Stdout: ioutil.Discard, PTY: true,
+				})
+			So(err, ShouldBeNil)
+			So(res.ExitCode, ShouldEqual, 0)
+
+			// Input after the script exits is left for us to read. Stdin
+			// may have been made blocking, so it's read with a timeout.
+			read := make(chan string, 1)
+			go func() {
+				b := make([]byte, 1)
+				n, _ := r.Read(b)
+				read <- string(b[:n])
+			}()
+			w.Write([]byte("x"))
+
+			var got string
+			select {
+			case got = <-read:
+			case <-time.After(time.Second):
+			}
+			So(got, ShouldEqual, "x")
+		})
+
+	Convey("Should resize the pseudo-terminal", t, func() {
+		proc, err := StartExec(context.Background(), e, []string{},
+			ScriptOptions{PTY: true})
+		So(err, ShouldBeNil)
+		So(proc.Stderr, ShouldBeNil)
+
+		So(proc.Resize(40, 100), ShouldBeNil)
+		proc.Stdin.Write([]byte("foo\n"))
+		out, err := ioutil.ReadAll(proc.Stdout)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEndWith, "40 100\r\n")
+
+		res, err := proc.Wait()
+		So(err, ShouldBeNil)
+		So(res.ExitCode, ShouldEqual, 0)
+	})
+
+	Convey("Should not resize a script without a pseudo-terminal", t, func() {
+		proc, err := StartExec(context.Background(), e, []string{},
+			ScriptOptions{})
+		So(err, ShouldBeNil)
+		So(proc.Resize(40, 100), ShouldEqual, errNoPTY)
+		proc.Stdin.Close()
+		proc.Wait()
+	})
+}
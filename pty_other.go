@@ -0,0 +1,45 @@
+//go:build !linux
+// +build !linux
+
+package goscriptify
+
+import (
+	"os"
+	"os/exec"
+	"time"
+)
+
+// openPTY returns ErrPTYUnsupported, as pseudo-terminals are only
+// supported on Linux.
+func openPTY() (master, slave *os.File, err error) {
+	return nil, nil, ErrPTYUnsupported
+}
+
+// setControllingTTY is a noop, as no pseudo-terminal can be opened.
+func setControllingTTY(cmd *exec.Cmd) {}
+
+// getWinsize returns ErrPTYUnsupported.
+func getWinsize(f *os.File) (rows, cols int, err error) {
+	return 0, 0, ErrPTYUnsupported
+}
+
+// setWinsize returns ErrPTYUnsupported.
+func setWinsize(f *os.File, rows, cols int) error {
+	return ErrPTYUnsupported
+}
+
+// makeRaw returns ErrPTYUnsupported.
+func makeRaw(f *os.File) (restore func(), err error) {
+	return nil, ErrPTYUnsupported
+}
+
+// notifyResize is a noop, as no pseudo-terminal can be opened.
+func notifyResize(c chan<- os.Signal) (stop func()) {
+	return func() {}
+}
+
+// waitReadable reports f as readable, as pseudo-terminals are only
+// supported on Linux.
+func waitReadable(f *os.File, timeout time.Duration) (bool, error) {
+	return true, nil
+}
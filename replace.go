@@ -0,0 +1,124 @@
+package goscriptify
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// ErrExecUnsupported is returned when replacing this process with a
+// script is not supported on this platform.
+var ErrExecUnsupported = errors.New("Replacing the process with a " +
+	"script is only supported on Unix")
+
+// ExecScriptsContext copies and compiles the given scripts, and then
+// replaces this process with the compiled script via execve. The script
+// keeps this process's PID, stdio, terminal and signal handling.
+//
+// Only the build is stopped by ctx or opts.Timeout, and the stdio of
+// opts is ignored, as the script inherits the stdio of this process.
+//
+// ExecScriptsContext only returns if building or the exec fails.
+func ExecScriptsContext(ctx context.Context, scripts, args []string,
+	opts ScriptOptions) error {
+	if runtime.GOOS == "windows" {
+		return ErrExecUnsupported
+	}
+
+	ctx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	c, err := compileScripts(ctx, scripts, opts, compileExec)
+	if err != nil {
+		return err
+	}
+
+	cancel()
+	return execCompiled(c, args, opts)
+}
+
+// ExecScriptDirContext compiles the given go package directory, and
+// then replaces this process with the compiled script via execve. See
+// ExecScriptsContext.
+func ExecScriptDirContext(ctx context.Context, dir string, args []string,
+	opts ScriptOptions) error {
+	if runtime.GOOS == "windows" {
+		return ErrExecUnsupported
+	}
+
+	ctx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	c, err := compileDir(ctx, dir, opts, compileExec)
+	if err != nil {
+		return err
+	}
+
+	cancel()
+	return execCompiled(c, args, opts)
+}
+
+// checkExecutable returns an error if p is not an executable file, so
+// that the exec of p is unlikely to fail.
+func checkExecutable(p string) error {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() || fi.Mode()&0111 == 0 {
+		return &os.PathError{Op: "exec", Path: p, Err: os.ErrPermission}
+	}
+	return nil
+}
+
+// execCompiled replaces this process with the compiled script, in the
+// working directory and environment described by opts.
+func execCompiled(c *compiled, args []string, opts ScriptOptions) error {
+	if opts.Sandbox != nil {
+		return ErrSandboxUnsupported
+	}
+
+	p, err := filepath.Abs(c.Bin)
+	if err != nil {
+		return err
+	}
+
+	dir, err := opts.workDir(c.Dir)
+	if err != nil {
+		return err
+	}
+
+	env, err := opts.environ(c)
+	if err != nil {
+		return err
+	}
+
+	// Everything which can be checked is, before this process is changed
+	// for the script.
+	if err := checkExecutable(p); err != nil {
+		return err
+	}
+
+	// The limits and working directory are inherited through the exec,
+	// and restored if it fails, leaving this process as it was.
+	restore, err := limitSelf(opts.Limits)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	if dir != "" {
+		old, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		if err := os.Chdir(dir); err != nil {
+			return err
+		}
+		defer os.Chdir(old)
+	}
+
+	return execBin(p, args, env)
+}
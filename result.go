@@ -0,0 +1,85 @@
+package goscriptify
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// RunResult describes how a script was built and run, and how it exited.
+type RunResult struct {
+	// ExitCode is the exit code of the script, or -1 if it was
+	// terminated by a signal.
+	ExitCode int
+
+	// Signal is the signal which terminated the script, if any.
+	Signal syscall.Signal
+
+	// CoreDumped is true if the signal caused the script to dump core.
+	CoreDumped bool
+
+	// WallTime is how long the script ran for.
+	WallTime time.Duration
+
+	// UserTime and SystemTime are the CPU time used by the script.
+	UserTime   time.Duration
+	SystemTime time.Duration
+
+	// MaxRSS is the maximum resident set size of the script in bytes,
+	// or 0 if unknown.
+	MaxRSS int64
+
+	// Bin is the path of the executable that was run.
+	Bin string
+
+	// Cached is true if the compiled script was up to date, and not
+	// rebuilt.
+	Cached bool
+
+	// BuildTime is how long was spent compiling, and vetting, the script
+	// before it was run.
+	BuildTime time.Duration
+
+	// LimitExceeded is the ScriptOptions.Limits limit that the script
+	// was stopped for exceeding, if any. See Limits for those which can
+	// be detected.
+	LimitExceeded Limit
+}
+
+// Signaled returns whether the script was terminated by a signal.
+func (r *RunResult) Signaled() bool {
+	return r.Signal != 0
+}
+
+// Status returns the exit status that a shell would report for the
+// script. This is the ExitCode, or 128+N if terminated by signal N.
+func (r *RunResult) Status() int {
+	if r.Signaled() {
+		return 128 + int(r.Signal)
+	}
+	return r.ExitCode
+}
+
+// status returns the Status of the result, or 0 if there's no result,
+// for the functions returning a bare exit status.
+func (r *RunResult) status() int {
+	if r == nil {
+		return 0
+	}
+	return r.Status()
+}
+
+// resultOf returns the RunResult of an exited process.
+func resultOf(state *os.ProcessState) *RunResult {
+	res := &RunResult{
+		ExitCode:   state.ExitCode(),
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+		MaxRSS:     maxRSS(state),
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		res.Signal = status.Signal()
+		res.CoreDumped = status.CoreDump()
+	}
+	return res
+}
@@ -0,0 +1,9 @@
+package goscriptify
+
+import "os"
+
+// maxRSS returns 0, as Windows doesn't report the resident set size of
+// exited processes.
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
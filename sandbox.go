@@ -0,0 +1,50 @@
+package goscriptify
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSandboxUnsupported is returned when ScriptOptions.Sandbox is given
+// on a platform, or by a run mode, that cannot sandbox scripts.
+var ErrSandboxUnsupported = errors.New("Sandboxed scripts are only " +
+	"supported when run as a child process on Linux")
+
+// Sandbox runs a script within new user, mount, pid and network
+// namespaces. The script sees the filesystem read only, except for the
+// Writable paths, and has no network unless Network is set.
+//
+// Within the sandbox the script runs as root, mapped to our own user,
+// beneath an init process which relays signals to it. A script
+// terminated by signal N is reported by the exit code 128+N.
+//
+// Sandboxing requires unprivileged user namespaces, and the go tool to
+// compile the sandbox init process into ScriptOptions.Temp.
+type Sandbox struct {
+	// Writable are the paths which remain writable within the sandbox,
+	// such as an output directory.
+	Writable []string
+
+	// Network shares the network of this process with the sandbox.
+	// Otherwise the sandbox only has a loopback interface.
+	Network bool
+}
+
+// SandboxError is returned when a sandbox cannot be created, such as
+// when unprivileged user namespaces are disabled.
+type SandboxError struct {
+	Reason string
+	Err    error
+}
+
+func (e *SandboxError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("goscriptify: cannot sandbox script: %s", e.Reason)
+	}
+	return fmt.Sprintf("goscriptify: cannot sandbox script: %s: %s",
+		e.Reason, e.Err)
+}
+
+func (e *SandboxError) Unwrap() error {
+	return e.Err
+}
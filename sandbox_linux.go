@@ -0,0 +1,151 @@
+package goscriptify
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// sandboxInitSrc is the source of the sandbox init process, which is
+// compiled into ScriptOptions.Temp on first use.
+//
+//go:embed sandboxinit/main.go
+var sandboxInitSrc string
+
+// sandboxConfig is given to the sandbox init process, and must match
+// its config.
+type sandboxConfig struct {
+	Writable []string
+	Dir      string
+	Network  bool
+}
+
+// sandboxCmd changes the cmd to run its executable within the sandbox,
+// beneath the sandbox init process.
+func sandboxCmd(ctx context.Context, cmd *exec.Cmd, sb *Sandbox,
+	opts ScriptOptions) error {
+	if err := checkUserNamespaces(); err != nil {
+		return err
+	}
+
+	init, err := buildHelper(ctx, "sandbox-init", sandboxInitSrc, opts)
+	if err != nil {
+		return err
+	}
+
+	c := sandboxConfig{Dir: cmd.Dir, Network: sb.Network}
+	if c.Dir == "" {
+		if c.Dir, err = os.Getwd(); err != nil {
+			return err
+		}
+	}
+	for _, p := range sb.Writable {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		c.Writable = append(c.Writable, abs)
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	cmd.Args = append([]string{init, string(b), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = init
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER |
+		syscall.CLONE_NEWNS | syscall.CLONE_NEWPID
+	if !sb.Network {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{
+		{ContainerID: 0, HostID: os.Getuid(), Size: 1},
+	}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{
+		{ContainerID: 0, HostID: os.Getgid(), Size: 1},
+	}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+
+	return nil
+}
+
+// checkUserNamespaces returns a SandboxError if the kernel settings
+// prevent us from creating a user namespace.
+func checkUserNamespaces() error {
+	if readSysctl("user/max_user_namespaces") == "0" {
+		return &SandboxError{Reason: "user namespaces are disabled " +
+			"(user.max_user_namespaces is 0)"}
+	}
+
+	if os.Getuid() == 0 {
+		return nil
+	}
+	if readSysctl("kernel/unprivileged_userns_clone") == "0" {
+		return &SandboxError{Reason: "unprivileged user namespaces are " +
+			"disabled (kernel.unprivileged_userns_clone is 0)"}
+	}
+	if readSysctl("kernel/apparmor_restrict_unprivileged_userns") == "1" {
+		return &SandboxError{Reason: "unprivileged user namespaces are " +
+			"restricted by AppArmor " +
+			"(kernel.apparmor_restrict_unprivileged_userns is 1)"}
+	}
+	return nil
+}
+
+// readSysctl returns the trimmed value of the named /proc/sys file, or
+// empty if it cannot be read.
+func readSysctl(name string) string {
+	b, err := os.ReadFile(filepath.Join("/proc/sys", name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// sandboxStartError returns a SandboxError if err is the kernel refusing
+// to create the sandbox namespaces for the cmd, and otherwise err.
+//
+// The errnos the kernel refuses with are also returned for unrelated
+// failures, such as an EINVAL for the cgroup of the cmd, so the
+// namespaces are created again by themselves to tell them apart.
+func sandboxStartError(cmd *exec.Cmd, err error) error {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return err
+	}
+
+	switch errno {
+	case syscall.EPERM, syscall.EACCES, syscall.EINVAL, syscall.ENOSPC,
+		syscall.EUSERS:
+	default:
+		return err
+	}
+
+	attr := cmd.SysProcAttr
+	probe := exec.Command(cmd.Path)
+	probe.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:                 attr.Cloneflags,
+		UidMappings:                attr.UidMappings,
+		GidMappings:                attr.GidMappings,
+		GidMappingsEnableSetgroups: attr.GidMappingsEnableSetgroups,
+	}
+	if perr := probe.Start(); perr != nil {
+		return &SandboxError{
+			Reason: "creating namespaces failed",
+			Err:    err,
+		}
+	}
+	// Without any args, the helper exits straight away.
+	probe.Wait()
+	return err
+}
@@ -0,0 +1,75 @@
+package goscriptify
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSandbox(t *testing.T) {
+	e := filepath.Join("_test", "fixtures", "sandbox.bash")
+	tmpDir := filepath.Join("_test", "tmp")
+	writable := filepath.Join(tmpDir, "sandbox-writable")
+	readOnly := filepath.Join(tmpDir, "sandbox-readonly")
+	os.MkdirAll(writable, 0755)
+	os.MkdirAll(readOnly, 0755)
+	defer os.RemoveAll(writable)
+	defer os.RemoveAll(readOnly)
+
+	run := func(sb *Sandbox) (string, error) {
+		var stdout bytes.Buffer
+		res, err := RunExecContext(context.Background(), e,
+			[]string{writable, readOnly}, ScriptOptions{
+				Temp:   tmpDir,
+				Stdout: &stdout, Stderr: ioutil.Discard,
+				Sandbox: sb,
+			})
+		if err == nil && res.ExitCode != 0 {
+			t.Fatalf("sandbox exited %d", res.ExitCode)
+		}
+		return stdout.String(), err
+	}
+
+	if _, err := run(&Sandbox{}); err != nil {
+		if _, ok := err.(*SandboxError); ok {
+			t.Skip(err)
+		}
+	}
+
+	Convey("Should only allow writes to writable paths", t, func() {
+		out, err := run(&Sandbox{Writable: []string{writable}})
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, "1\nwritable\nread only\n1\n")
+
+		_, err = os.Stat(filepath.Join(readOnly, "file"))
+		So(os.IsNotExist(err), ShouldBeTrue)
+	})
+
+	Convey("Should not let the script remount read only paths", t, func() {
+		var stdout bytes.Buffer
+		e := filepath.Join("_test", "fixtures", "sandbox_remount.bash")
+		res, err := RunExecContext(context.Background(), e,
+			[]string{readOnly}, ScriptOptions{
+				Temp:   tmpDir,
+				Stdout: &stdout, Stderr: ioutil.Discard,
+				Sandbox: &Sandbox{},
+			})
+		So(err, ShouldBeNil)
+		So(res.ExitCode, ShouldEqual, 0)
+		So(stdout.String(), ShouldEqual, "read only\n")
+
+		_, err = os.Stat(filepath.Join(readOnly, "file"))
+		So(os.IsNotExist(err), ShouldBeTrue)
+	})
+
+	Convey("Should share the network if requested", t, func() {
+		out, err := run(&Sandbox{Writable: []string{writable}, Network: true})
+		So(err, ShouldBeNil)
+		So(out, ShouldNotEndWith, "\n1\n")
+	})
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package goscriptify
+
+import (
+	"context"
+	"os/exec"
+)
+
+// sandboxCmd returns ErrSandboxUnsupported, as namespaces are Linux
+// only.
+func sandboxCmd(ctx context.Context, cmd *exec.Cmd, sb *Sandbox,
+	opts ScriptOptions) error {
+	return ErrSandboxUnsupported
+}
+
+// sandboxStartError returns err, as no sandbox can be started.
+func sandboxStartError(cmd *exec.Cmd, err error) error {
+	return err
+}
@@ -0,0 +1,288 @@
+//go:build linux
+// +build linux
+
+// # Sandbox Init
+//
+// Command sandboxinit is the init process of a goscriptify sandbox.
+// goscriptify compiles it, and starts it in new user, mount and pid
+// namespaces, where it makes the filesystem read only except for the
+// writable paths, before running the script as its child. The script is
+// given nested user and mount namespaces, so that it cannot undo the
+// read only mounts.
+//
+// Usage:
+//
+//	sandboxinit <config json> <script> [args...]
+//
+// As pid 1 of the sandbox it relays signals to the script, and reaps
+// any orphaned processes. It exits with the exit code of the script, or
+// 128+N if the script was terminated by signal N.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// config is the sandbox configuration given by goscriptify.
+type config struct {
+	// Writable are the absolute paths which remain writable.
+	Writable []string
+
+	// Dir is the working directory of the script.
+	Dir string
+
+	// Network is true if the sandbox shares the network of the host.
+	// Otherwise it has a network namespace, with only loopback.
+	Network bool
+}
+
+// The statfs flags which are locked on a mount, and must be preserved
+// when remounting it within a user namespace.
+const lockedFlags = syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC |
+	syscall.MS_NOATIME | syscall.MS_NODIRATIME | syscall.MS_RELATIME
+
+func main() {
+	if len(os.Args) < 3 {
+		fatal(fmt.Errorf("usage: sandboxinit <config json> <script> [args...]"))
+	}
+
+	var c config
+	if err := json.Unmarshal([]byte(os.Args[1]), &c); err != nil {
+		fatal(err)
+	}
+
+	if err := setup(c); err != nil {
+		fatal(err)
+	}
+
+	os.Exit(run(os.Args[2], os.Args[3:]))
+}
+
+// fatal reports an error setting up the sandbox, and exits with 126 as
+// a shell would for a script that cannot be run.
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "goscriptify sandbox: %s\n", err)
+	os.Exit(126)
+}
+
+// setup makes the filesystem read only except for the writable paths,
+// mounts a /proc for our pid namespace and brings up loopback.
+func setup(c config) error {
+	// Keep our mounts from propagating back to the host.
+	err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, "")
+	if err != nil {
+		return fmt.Errorf("making mounts private: %s", err)
+	}
+
+	// Writable paths are bound to themselves, so that they're mounts of
+	// their own which the read only remounts can skip.
+	for _, p := range c.Writable {
+		err := syscall.Mount(p, p, "", syscall.MS_BIND|syscall.MS_REC, "")
+		if err != nil {
+			return fmt.Errorf("binding writable path %s: %s", p, err)
+		}
+	}
+
+	mounts, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	for _, m := range mounts {
+		// Mounts beneath /proc are replaced by our own /proc below.
+		if isWithin(m, "/proc") || isWritable(m, c.Writable) {
+			continue
+		}
+		if err := remountReadOnly(m); err != nil {
+			return fmt.Errorf("remounting %s read only: %s", m, err)
+		}
+	}
+
+	err = syscall.Mount("proc", "/proc", "proc",
+		syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "")
+	if err != nil {
+		return fmt.Errorf("mounting /proc: %s", err)
+	}
+
+	if !c.Network {
+		if err := loopbackUp(); err != nil {
+			return fmt.Errorf("bringing up loopback: %s", err)
+		}
+	}
+
+	// Our working directory is still that of the host mount, so it's
+	// looked up again to move to the read only view of it.
+	if c.Dir != "" {
+		if err := os.Chdir(c.Dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mountPoints returns the mount points of our mount namespace, parents
+// before their children.
+func mountPoints() ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mounts []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mounts = append(mounts, unescapeMountPoint(fields[4]))
+	}
+	return mounts, s.Err()
+}
+
+// unescapeMountPoint decodes the octal escapes, such as \040 for space,
+// of a mountinfo mount point.
+func unescapeMountPoint(m string) string {
+	var b strings.Builder
+	for i := 0; i < len(m); i++ {
+		if m[i] == '\\' && i+3 < len(m) {
+			var c byte
+			if _, err := fmt.Sscanf(m[i+1:i+4], "%03o", &c); err == nil {
+				b.WriteByte(c)
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(m[i])
+	}
+	return b.String()
+}
+
+// remountReadOnly makes the mount at m read only, keeping the flags
+// which are locked within a user namespace.
+func remountReadOnly(m string) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(m, &st); err != nil {
+		// The mount point may be hidden by another mount.
+		return nil
+	}
+
+	flags := uintptr(st.Flags)&lockedFlags |
+		syscall.MS_REMOUNT | syscall.MS_BIND | syscall.MS_RDONLY
+	return syscall.Mount("", m, "", flags, "")
+}
+
+// isWritable returns whether the mount point m is one of the writable
+// paths, or within one.
+func isWritable(m string, writable []string) bool {
+	for _, p := range writable {
+		if isWithin(m, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithin returns whether p is dir, or beneath it.
+func isWithin(p, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// loopbackUp brings up the loopback interface of our network namespace.
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET,
+		syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	// struct ifreq, of the interface name and its flags.
+	var ifr [40]byte
+	copy(ifr[:], "lo")
+	flags := (*uint16)(unsafe.Pointer(&ifr[syscall.IFNAMSIZ]))
+
+	if err := ioctl(fd, syscall.SIOCGIFFLAGS, &ifr); err != nil {
+		return err
+	}
+	*flags |= syscall.IFF_UP
+	return ioctl(fd, syscall.SIOCSIFFLAGS, &ifr)
+}
+
+func ioctl(fd int, req uintptr, ifr *[40]byte) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req,
+		uintptr(unsafe.Pointer(ifr)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// run runs the script as our child, relaying signals to it and reaping
+// any orphans until it exits. It returns the exit status of the script.
+func run(script string, args []string) int {
+	sigs := make(chan os.Signal, 16)
+	signal.Notify(sigs)
+
+	// The script would have every capability within our user namespace,
+	// and so could remount the read only paths as writable. Instead it's
+	// given user and mount namespaces of its own, in which the kernel
+	// locks our mounts, and their flags, from being changed or removed.
+	proc, err := os.StartProcess(script, append([]string{script}, args...),
+		&os.ProcAttr{
+			Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+			Sys: &syscall.SysProcAttr{
+				Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS,
+				UidMappings: []syscall.SysProcIDMap{
+					{ContainerID: 0, HostID: 0, Size: 1},
+				},
+				GidMappings: []syscall.SysProcIDMap{
+					{ContainerID: 0, HostID: 0, Size: 1},
+				},
+			},
+		})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goscriptify sandbox: %s\n", err)
+		return 127
+	}
+
+	go func() {
+		for sig := range sigs {
+			// SIGURG is used by the Go runtime for preemption.
+			if sig == syscall.SIGCHLD || sig == syscall.SIGURG {
+				continue
+			}
+			proc.Signal(sig)
+		}
+	}()
+
+	for {
+		var ws syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &ws, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "goscriptify sandbox: %s\n", err)
+			return 1
+		}
+		if pid != proc.Pid {
+			continue
+		}
+
+		if ws.Signaled() {
+			return 128 + int(ws.Signal())
+		}
+		return ws.ExitStatus()
+	}
+}
@@ -0,0 +1,67 @@
+package scriptinfo
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// The environment variables goscriptify sets when running a script.
+const (
+	// EnvScript is the absolute path of the script, or script dir, being
+	// run.
+	EnvScript = "GOSCRIPTIFY_SCRIPT"
+
+	// EnvScriptDir is the absolute path of the directory containing the
+	// script, or the script dir itself.
+	EnvScriptDir = "GOSCRIPTIFY_SCRIPT_DIR"
+
+	// EnvVersion is the version of goscriptify running the script.
+	EnvVersion = "GOSCRIPTIFY_VERSION"
+
+	// EnvDepth is how many goscriptify scripts are running the script,
+	// including itself. A script run directly has a depth of 1.
+	EnvDepth = "GOSCRIPTIFY_DEPTH"
+)
+
+// Script returns the absolute path of the running script, or script
+// dir. Unlike os.Executable, this is the original script rather than
+// its cached binary. It falls back to the stamped Path, if not set.
+func Script() string {
+	if p := os.Getenv(EnvScript); p != "" {
+		return p
+	}
+	return Path()
+}
+
+// Dir returns the absolute path of the directory of the running script,
+// or the script dir itself. Empty is returned if unknown.
+func Dir() string {
+	if d := os.Getenv(EnvScriptDir); d != "" {
+		return d
+	}
+
+	p := Path()
+	if p == "" {
+		return ""
+	}
+	if info, err := os.Stat(p); err == nil && info.IsDir() {
+		return p
+	}
+	return filepath.Dir(p)
+}
+
+// Join joins the given path elements to the script Dir, for locating
+// files alongside the script. Such as:
+//
+//	config := scriptinfo.Join("config.json")
+func Join(elem ...string) string {
+	return filepath.Join(append([]string{Dir()}, elem...)...)
+}
+
+// Depth returns how many goscriptify scripts are running this script,
+// including itself. Zero is returned if not run by goscriptify.
+func Depth() int {
+	d, _ := strconv.Atoi(os.Getenv(EnvDepth))
+	return d
+}
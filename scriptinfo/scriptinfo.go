@@ -0,0 +1,61 @@
+// # ScriptInfo
+//
+// Package scriptinfo describes the running goscriptify script. The
+// values are stamped into the script when goscriptify compiles it, and
+// are empty if the script was built by other means.
+//
+// The location of the script is also available from the environment
+// variables set when goscriptify runs it. See Script and Dir.
+package scriptinfo
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Stamped by goscriptify with `-ldflags -X`
+var (
+	paths     string
+	hash      string
+	buildTime string
+	version   string
+)
+
+// Path returns the original path of the script, or script dir, that
+// this binary was compiled from. If it was compiled from multiple
+// scripts, the first is returned.
+func Path() string {
+	ps := Paths()
+	if len(ps) == 0 {
+		return ""
+	}
+	return ps[0]
+}
+
+// Paths returns the original paths of every script that this binary was
+// compiled from.
+func Paths() []string {
+	if paths == "" {
+		return nil
+	}
+	return strings.Split(paths, string(filepath.ListSeparator))
+}
+
+// Hash returns the hash of the script contents this binary was compiled
+// from.
+func Hash() string {
+	return hash
+}
+
+// BuildTime returns when the script contents were first compiled. The
+// zero time is returned if unknown.
+func BuildTime() time.Time {
+	t, _ := time.Parse(time.RFC3339, buildTime)
+	return t
+}
+
+// Version returns the goscriptify version which compiled this binary.
+func Version() string {
+	return version
+}
@@ -0,0 +1,52 @@
+package scriptinfo
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPaths(t *testing.T) {
+	Convey("Should split the stamped paths", t, func() {
+		paths = "/foo/Builder:/foo/helpers.go"
+		defer func() { paths = "" }()
+		So(Paths(), ShouldResemble, []string{"/foo/Builder", "/foo/helpers.go"})
+		So(Path(), ShouldEqual, "/foo/Builder")
+	})
+
+	Convey("Should be empty if not stamped", t, func() {
+		So(Paths(), ShouldBeNil)
+		So(Path(), ShouldEqual, "")
+	})
+}
+
+func TestBuildTime(t *testing.T) {
+	Convey("Should be the zero time if not stamped", t, func() {
+		So(BuildTime().IsZero(), ShouldBeTrue)
+	})
+}
+
+func TestScriptEnv(t *testing.T) {
+	Convey("Should read the script location from the env", t, func() {
+		os.Setenv(EnvScript, "/foo/Builder")
+		os.Setenv(EnvScriptDir, "/foo")
+		os.Setenv(EnvDepth, "2")
+		defer os.Unsetenv(EnvScript)
+		defer os.Unsetenv(EnvScriptDir)
+		defer os.Unsetenv(EnvDepth)
+
+		So(Script(), ShouldEqual, "/foo/Builder")
+		So(Dir(), ShouldEqual, "/foo")
+		So(Join("config.json"), ShouldEqual, "/foo/config.json")
+		So(Depth(), ShouldEqual, 2)
+	})
+
+	Convey("Should fall back to the stamped path", t, func() {
+		paths = "/foo/Builder"
+		defer func() { paths = "" }()
+		So(Script(), ShouldEqual, "/foo/Builder")
+		So(Dir(), ShouldEqual, "/foo")
+		So(Depth(), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,323 @@
+package goscriptify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// TestStatus is the outcome of a single test.
+type TestStatus string
+
+const (
+	TestPass TestStatus = "pass"
+	TestFail TestStatus = "fail"
+	TestSkip TestStatus = "skip"
+)
+
+// TestCase is the result of a single test function.
+type TestCase struct {
+	Package string
+	Name    string
+	Status  TestStatus
+	Elapsed time.Duration
+
+	// The output written by the test, including the go test summary.
+	Output string
+}
+
+// TestResult is the result of running the tests of a script.
+type TestResult struct {
+	// Passed is true if the tests built, and neither they nor their
+	// packages failed.
+	Passed bool
+
+	Tests []TestCase
+
+	// Output is the output of the test packages which doesn't belong to
+	// any test, such as a panic in an init func, or the exit status of
+	// a TestMain.
+	Output string
+}
+
+// RunScriptTests copies the given scripts, and runs the tests within
+// them with go test. Extensionless scripts are staged just as they are
+// by RunScriptsWithOpts, so a "Builder_test" script is a test file.
+//
+// The test output is streamed to opts.Stdout, and the given args are
+// passed to go test, eg "-run" "TestFoo".
+func RunScriptTests(ctx context.Context, scripts, args []string,
+	opts ScriptOptions) (*TestResult, error) {
+	ctx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	tc, err := scriptToolchain(scripts, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	binDst, _, err := GetBinDest(scripts, opts.Temp, tc.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	// The copied scripts are shared with compileScripts.
+	unlock, err := lockBin(binDst)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	srcDir := scriptSrcDir(binDst)
+	scriptPaths := newScriptSrcPaths(srcDir, scripts)
+	defer os.RemoveAll(srcDir)
+
+	err = copyScriptSrcs(srcDir, scriptPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	srcs := make([]string, len(scriptPaths))
+	for i, s := range scriptPaths {
+		srcs[i] = s.Generated
+	}
+
+	// The test output refers to the generated file names, so replace
+	// them with the original names as the output is written.
+	var names []string
+	for _, s := range scriptPaths {
+		if s.Original != s.Generated {
+			names = append(names, filepath.Base(s.Generated),
+				filepath.Base(s.Original))
+		}
+	}
+
+	args = append(append([]string{"test", "-json"}, args...), srcs...)
+	res, err := goTest(ctx, "", args, tc, strings.NewReplacer(names...), opts)
+	return res, originalBuildError(err, scriptPaths)
+}
+
+// RunScriptDirTests runs the tests of the go package directory with go
+// test.
+//
+// The test output is streamed to opts.Stdout, and the given args are
+// passed to go test, eg "-run" "TestFoo".
+func RunScriptDirTests(ctx context.Context, dir string, args []string,
+	opts ScriptOptions) (*TestResult, error) {
+	ctx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	srcs, err := dirSources(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	tc, err := scriptToolchain(srcs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Generate {
+		err = generateTestDir(ctx, dir, tc, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	args = append(append([]string{"test", "-json"}, args...), ".")
+	return goTest(ctx, dir, args, tc, strings.NewReplacer(), opts)
+}
+
+// generateTestDir runs the go:generate directives of the script dir, as
+// compileDir does, so that its tests build against the same sources.
+func generateTestDir(ctx context.Context, dir string, tc Toolchain,
+	opts ScriptOptions) error {
+	binDst, _, err := GetBinDest([]string{dir}, opts.Temp, tc.Version)
+	if err != nil {
+		return err
+	}
+
+	// The generate stamp is shared with compileDir.
+	unlock, err := lockBin(binDst)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return generateDir(ctx, generateStampPath(binDst), dir, tc, opts)
+}
+
+// goTest runs go test with the given args, which must include -json,
+// and collects the result of each test. If the tests cannot be built,
+// a BuildError is returned.
+func goTest(ctx context.Context, dir string, args []string, tc Toolchain,
+	names *strings.Replacer, opts ScriptOptions) (*TestResult, error) {
+	w := &testEventWriter{
+		out:   opts.Stdout,
+		names: names,
+		tests: map[string]*TestCase{},
+	}
+
+	var stderr bytes.Buffer
+	err := runGo(ctx, "test", dir, args, opts.buildOptions(tc), w, &stderr)
+	w.flush()
+
+	res := &TestResult{
+		Passed: err == nil,
+		Output: w.output.String(),
+	}
+	for _, k := range w.order {
+		res.Tests = append(res.Tests, *w.tests[k])
+	}
+
+	if err != nil {
+		exiterr, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, err
+		}
+
+		// Failing tests, and packages, also exit non-zero. Anything the
+		// tool itself reports goes with the package output.
+		if !w.buildFailed {
+			res.Output += names.Replace(stderr.String())
+			return res, nil
+		}
+
+		exit := 1
+		if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+			exit = status.ExitStatus()
+		}
+		return nil, &BuildError{
+			Exit:    exit,
+			Message: w.buildOutput.String() + names.Replace(stderr.String()),
+		}
+	}
+
+	return res, nil
+}
+
+// testEvent is a single go test -json event, as described by
+// `go doc test2json`.
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+
+	// FailedBuild is the package which failed to build, on the fail
+	// event of a package whose tests couldn't be built.
+	FailedBuild string
+}
+
+// testEventWriter decodes the go test -json events written to it,
+// streaming the test output to out and collecting each test result.
+type testEventWriter struct {
+	out   io.Writer
+	names *strings.Replacer
+	buf   bytes.Buffer
+
+	// Tests by package and name, and the order they started in.
+	tests map[string]*TestCase
+	order []string
+
+	// Output of the packages, rather than any test.
+	output bytes.Buffer
+
+	buildOutput bytes.Buffer
+	buildFailed bool
+}
+
+func (w *testEventWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i == -1 {
+			break
+		}
+		w.handle(w.buf.Next(i + 1))
+	}
+	return len(p), nil
+}
+
+// flush handles any final, unterminated, line.
+func (w *testEventWriter) flush() {
+	if w.buf.Len() > 0 {
+		w.handle(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+func (w *testEventWriter) handle(line []byte) {
+	var e testEvent
+	if err := json.Unmarshal(line, &e); err != nil {
+		// Not an event, so just pass it along.
+		w.write(string(line))
+		return
+	}
+
+	switch e.Action {
+	case "build-output":
+		w.buildOutput.WriteString(w.names.Replace(e.Output))
+		return
+	case "build-fail":
+		w.buildFailed = true
+		return
+	case "output":
+		w.write(e.Output)
+	}
+
+	// Package level events have no test
+	if e.Test == "" {
+		w.handlePackage(e)
+		return
+	}
+
+	k := e.Package + "." + e.Test
+	t, ok := w.tests[k]
+	if !ok {
+		t = &TestCase{Package: e.Package, Name: e.Test}
+		w.tests[k] = t
+		w.order = append(w.order, k)
+	}
+
+	switch TestStatus(e.Action) {
+	case TestPass, TestFail, TestSkip:
+		t.Status = TestStatus(e.Action)
+		t.Elapsed = time.Duration(e.Elapsed * float64(time.Second))
+	}
+	if e.Action == "output" {
+		t.Output += w.names.Replace(e.Output)
+	}
+}
+
+// handlePackage handles a package level event. Toolchains before go1.24
+// have no build-fail event, and only report the failed build in the
+// package output.
+func (w *testEventWriter) handlePackage(e testEvent) {
+	switch e.Action {
+	case "fail":
+		if e.FailedBuild != "" {
+			w.buildFailed = true
+		}
+	case "output":
+		if strings.HasSuffix(e.Output, " [build failed]\n") ||
+			strings.HasSuffix(e.Output, " [setup failed]\n") {
+			w.buildFailed = true
+		}
+		w.output.WriteString(w.names.Replace(e.Output))
+	}
+}
+
+func (w *testEventWriter) write(s string) {
+	if w.out != nil {
+		io.WriteString(w.out, w.names.Replace(s))
+	}
+}
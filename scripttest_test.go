@@ -0,0 +1,106 @@
+package goscriptify
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRunScriptTests(t *testing.T) {
+	fixDir := filepath.Join("_test", "fixtures")
+	tmpDir := filepath.Join("_test", "tmp")
+
+	Convey("Should run the tests of extensionless scripts", t, func() {
+		var stdout bytes.Buffer
+		res, err := RunScriptTests(context.Background(), []string{
+			filepath.Join(fixDir, "adder"),
+			filepath.Join(fixDir, "adder_test"),
+		}, []string{"-v"}, ScriptOptions{
+			Temp:  tmpDir,
+			Stdin: nil, Stdout: &stdout, Stderr: ioutil.Discard,
+		})
+		So(err, ShouldBeNil)
+		So(res.Passed, ShouldBeTrue)
+		So(len(res.Tests), ShouldEqual, 1)
+		So(res.Tests[0].Name, ShouldEqual, "TestAdd")
+		So(res.Tests[0].Status, ShouldEqual, TestPass)
+		So(stdout.String(), ShouldContainSubstring, "--- PASS: TestAdd")
+	})
+
+	Convey("Should return a BuildError if the tests can't build", t, func() {
+		_, err := RunScriptTests(context.Background(), []string{
+			filepath.Join(fixDir, "synerr.go"),
+		}, []string{}, ScriptOptions{
+			Temp:  tmpDir,
+			Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+		})
+		_, ok := err.(*BuildError)
+		So(ok, ShouldBeTrue)
+	})
+}
+
+func TestRunScriptDirTests(t *testing.T) {
+	dir := filepath.Join("_test", "fixtures", "tested_dir")
+
+	Convey("Should return the result of each test", t, func() {
+		res, err := RunScriptDirTests(context.Background(), dir, []string{},
+			ScriptOptions{
+				Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+			})
+		So(err, ShouldBeNil)
+		So(res.Passed, ShouldBeFalse)
+		So(len(res.Tests), ShouldEqual, 3)
+
+		statuses := map[string]TestStatus{}
+		for _, tc := range res.Tests {
+			statuses[tc.Name] = tc.Status
+		}
+		So(statuses["TestAdd"], ShouldEqual, TestPass)
+		So(statuses["TestFail"], ShouldEqual, TestFail)
+		So(statuses["TestSkip"], ShouldEqual, TestSkip)
+	})
+
+	Convey("Should pass args to go test", t, func() {
+		res, err := RunScriptDirTests(context.Background(), dir,
+			[]string{"-run", "TestAdd"}, ScriptOptions{
+				Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+			})
+		So(err, ShouldBeNil)
+		So(res.Passed, ShouldBeTrue)
+		So(len(res.Tests), ShouldEqual, 1)
+	})
+
+	Convey("Should fail packages which fail without a failing test", t,
+		func() {
+			res, err := RunScriptDirTests(context.Background(),
+				filepath.Join("_test", "fixtures", "testmain_dir"), []string{},
+				ScriptOptions{
+					Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+				})
+			So(err, ShouldBeNil)
+			So(res.Passed, ShouldBeFalse)
+			So(len(res.Tests), ShouldEqual, 0)
+			So(res.Output, ShouldContainSubstring, "exit status 3")
+		})
+
+	Convey("Should generate before testing, if enabled", t, func() {
+		dir := copyGenerateFixture()
+		opts := ScriptOptions{
+			Temp:  filepath.Join("_test", "tmp"),
+			Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+		}
+		_, err := RunScriptDirTests(context.Background(), dir, []string{}, opts)
+		_, ok := err.(*BuildError)
+		So(ok, ShouldBeTrue)
+
+		opts.Generate = true
+		res, err := RunScriptDirTests(context.Background(), dir, []string{},
+			opts)
+		So(err, ShouldBeNil)
+		So(res.Passed, ShouldBeTrue)
+	})
+}
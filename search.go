@@ -0,0 +1,193 @@
+package goscriptify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/leeola/goscriptify/utils"
+)
+
+// SearchBoundary is the directory at which an upward search for a
+// script stops.
+type SearchBoundary int
+
+const (
+	// SearchRepoRoot stops at the root of the repository being searched
+	// from, the nearest directory containing a .git, .hg, .svn or .bzr.
+	// Outside of a repository only the starting directory is searched.
+	SearchRepoRoot SearchBoundary = iota
+
+	// SearchHome stops at $HOME, if the search starts within it.
+	// Otherwise, it stops at the filesystem root.
+	SearchHome
+
+	// SearchRoot stops at the filesystem root.
+	SearchRoot
+)
+
+// repoMarkers are the entries which mark the root of a repository.
+var repoMarkers = []string{".git", ".hg", ".svn", ".bzr"}
+
+// FoundScript is a script, or script dir, found by an upward search.
+type FoundScript struct {
+	// Path is the absolute path of the script, or script dir.
+	Path string
+
+	// IsDir is true if Path is a script dir.
+	IsDir bool
+
+	// Dir is the absolute directory the script was found relative to.
+	// Scripts are usually run with it as their working directory.
+	Dir string
+}
+
+// SearchScript is FindScript, searching the working directory and then
+// each of its parents until the script is found, or the boundary is
+// reached. This allows scripts to be run from any subdirectory of a
+// project, as with make or git.
+//
+// Example:
+//
+//	SearchScript([]string{"Builder", "builder"}, SearchRepoRoot)
+//
+// Will search for both "Builder" and "builder" in the working directory,
+// and then its parents, up to the root of the repository.
+func SearchScript(ps []string, boundary SearchBoundary) (*FoundScript, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	return searchScript(cwd, homeDir(), ps, boundary)
+}
+
+// SearchScriptOrDir is FindScriptOrDir, searching the working directory
+// and then each of its parents until the script or dir is found, or the
+// boundary is reached. See SearchScript.
+func SearchScriptOrDir(ps []string, useDir bool,
+	boundary SearchBoundary) (*FoundScript, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	return searchScriptOrDir(cwd, homeDir(), ps, useDir, boundary)
+}
+
+// searchScript is the implementation of SearchScript with a testable
+// CWD and home.
+func searchScript(cwd, home string, ps []string,
+	boundary SearchBoundary) (*FoundScript, error) {
+	return search(cwd, home, ps, boundary,
+		func(dir string) (string, bool, []Candidate, bool) {
+			p, rejected, ok := lookupScript(dir, ps)
+			return p, false, rejected, ok
+		})
+}
+
+// searchScriptOrDir is the implementation of SearchScriptOrDir with a
+// testable CWD and home.
+func searchScriptOrDir(cwd, home string, ps []string, useDir bool,
+	boundary SearchBoundary) (*FoundScript, error) {
+	return search(cwd, home, ps, boundary,
+		func(dir string) (string, bool, []Candidate, bool) {
+			return lookupScriptOrDir(dir, ps, useDir)
+		})
+}
+
+// search searches cwd, and then each of its parents up to the boundary,
+// calling lookup for each until it finds the script. The candidates
+// rejected by every lookup are returned if the script isn't found.
+func search(cwd, home string, ps []string, boundary SearchBoundary,
+	lookup func(dir string) (p string, isDir bool, rejected []Candidate,
+		ok bool)) (*FoundScript, error) {
+	start, err := filepath.Abs(cwd)
+	if err != nil {
+		return nil, err
+	}
+	stop := searchStop(start, home, boundary)
+
+	var rejected []Candidate
+	for dir := start; ; {
+		p, isDir, dirRejected, ok := lookup(dir)
+		rejected = append(rejected, dirRejected...)
+		if ok {
+			return &FoundScript{
+				Path:  filepath.Join(dir, p),
+				IsDir: isDir,
+				Dir:   dir,
+			}, nil
+		}
+
+		// A script which was found but can't be built ends the search,
+		// rather than falling through to one in a parent.
+		n := len(dirRejected)
+		if n > 0 && dirRejected[n-1].Reason == RejectExtension {
+			break
+		}
+
+		parent := filepath.Dir(dir)
+		if dir == stop || parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	return nil, &NotFoundError{Scripts: ps, Candidates: rejected}
+}
+
+// searchStop returns the last directory to be searched from start, for
+// the given boundary. An empty stop searches up to the filesystem root.
+func searchStop(start, home string, boundary SearchBoundary) string {
+	switch boundary {
+	case SearchRepoRoot:
+		if root, ok := repoRoot(start); ok {
+			return root
+		}
+		return start
+	case SearchHome:
+		if home != "" && isWithin(start, home) {
+			return filepath.Clean(home)
+		}
+	}
+	return ""
+}
+
+// repoRoot returns the nearest directory of start, or its parents,
+// which contains a repository marker.
+func repoRoot(start string) (string, bool) {
+	for dir := start; ; {
+		for _, m := range repoMarkers {
+			if exists, _, _ := utils.Exists(filepath.Join(dir, m)); exists {
+				return dir, true
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// isWithin returns whether p is dir, or within it.
+func isWithin(p, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+	up := ".." + string(filepath.Separator)
+	return rel != ".." && !strings.HasPrefix(rel, up)
+}
+
+// homeDir returns the user's home directory, or an empty string if
+// it's unknown.
+func homeDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return home
+}
@@ -0,0 +1,104 @@
+package goscriptify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// makeTree creates the given empty files within root, and any dirs
+// needed for them.
+func makeTree(root string, ps ...string) error {
+	for _, p := range ps {
+		p = filepath.Join(root, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(p, nil, 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSearchScript(t *testing.T) {
+	Convey("Should search parent dirs", t, func() {
+		root, err := ioutil.TempDir("", "goscriptify-search")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(root)
+		root, err = filepath.EvalSymlinks(root)
+		So(err, ShouldBeNil)
+
+		So(makeTree(root,
+			"Builder",
+			"home/.git/config",
+			"home/project/.git/config",
+			"home/project/builder",
+			"home/project/a/Builder/dir/file",
+			"home/project/a/b/c/file",
+			"home/project/tools/build.go",
+			"home/other/file",
+		), ShouldBeNil)
+		home := filepath.Join(root, "home")
+		project := filepath.Join(home, "project")
+		deep := filepath.Join(project, "a", "b", "c")
+
+		Convey("Should find a script in the cwd", func() {
+			f, err := searchScript(project, home, []string{"builder"},
+				SearchRepoRoot)
+			So(err, ShouldBeNil)
+			So(f.Path, ShouldEqual, filepath.Join(project, "builder"))
+			So(f.Dir, ShouldEqual, project)
+			So(f.IsDir, ShouldBeFalse)
+		})
+
+		Convey("Should find a script in a parent, up to the repo root", func() {
+			f, err := searchScript(deep, home, []string{"builder"},
+				SearchRepoRoot)
+			So(err, ShouldBeNil)
+			So(f.Path, ShouldEqual, filepath.Join(project, "builder"))
+			So(f.Dir, ShouldEqual, project)
+		})
+
+		Convey("Should not return a dir", func() {
+			f, err := searchScript(deep, home, []string{"Builder", "builder"},
+				SearchRepoRoot)
+			So(err, ShouldBeNil)
+			So(f.Path, ShouldEqual, filepath.Join(project, "builder"))
+		})
+
+		Convey("Should stop at the boundary", func() {
+			_, err := searchScript(deep, home, []string{"Builder"},
+				SearchRepoRoot)
+			So(err, ShouldNotBeNil)
+
+			_, err = searchScript(deep, home, []string{"Builder"}, SearchHome)
+			So(err, ShouldNotBeNil)
+
+			f, err := searchScript(deep, home, []string{"Builder"}, SearchRoot)
+			So(err, ShouldBeNil)
+			So(f.Path, ShouldEqual, filepath.Join(root, "Builder"))
+			So(f.Dir, ShouldEqual, root)
+		})
+
+		Convey("Should stop at the filesystem root outside of home", func() {
+			f, err := searchScript(deep, filepath.Join(root, "other"),
+				[]string{"Builder"}, SearchHome)
+			So(err, ShouldBeNil)
+			So(f.Path, ShouldEqual, filepath.Join(root, "Builder"))
+		})
+
+		Convey("Should find a script dir in a parent", func() {
+			f, err := searchScriptOrDir(deep, home,
+				[]string{filepath.Join("tools", "build.go")}, true,
+				SearchRepoRoot)
+			So(err, ShouldBeNil)
+			So(f.Path, ShouldEqual, filepath.Join(project, "tools"))
+			So(f.Dir, ShouldEqual, project)
+			So(f.IsDir, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,397 @@
+package goscriptify
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leeola/goscriptify/utils"
+)
+
+// goDirective is the comment prefix declaring the minimum Go version
+// a script requires. Eg:
+//
+//	// gos:go 1.22
+const goDirective = "gos:go"
+
+// Toolchain is a Go SDK able to build scripts.
+type Toolchain struct {
+	// The path to the go command of the toolchain.
+	Go string
+
+	// The toolchain version, eg "go1.22.3".
+	Version string
+}
+
+// ToolchainError is returned when no toolchain satisfying a script's
+// go directive can be found.
+type ToolchainError struct {
+	// The minimum version required by the script.
+	Required string
+
+	// Every toolchain that was found, and rejected.
+	Found []Toolchain
+}
+
+func (e *ToolchainError) Error() string {
+	if len(e.Found) == 0 {
+		return fmt.Sprintf("Script requires go %s, but no Go toolchain "+
+			"could be found", e.Required)
+	}
+
+	found := make([]string, len(e.Found))
+	for i, tc := range e.Found {
+		found[i] = fmt.Sprintf("\t%s (%s)", tc.Version, tc.Go)
+	}
+	return fmt.Sprintf("Script requires go %s, but only found:\n%s",
+		e.Required, strings.Join(found, "\n"))
+}
+
+// FindToolchains returns every Go toolchain found in $GOROOT, $PATH and
+// the given sdk dirs, in that order.
+//
+// Each sdk dir may either be a toolchain itself, or contain toolchains,
+// such as the ~/sdk dir that golang.org/dl installs versions into.
+func FindToolchains(sdkDirs []string) []Toolchain {
+	return findToolchains(sdkDirs, "")
+}
+
+// findToolchains is FindToolchains, caching the toolchain versions at
+// cachePath if it's not empty. See toolchainCache.
+func findToolchains(sdkDirs []string, cachePath string) []Toolchain {
+	cache := loadToolchainCache(cachePath)
+	defer cache.save()
+
+	var tcs []Toolchain
+	seen := map[string]bool{}
+	for _, p := range toolchainCandidates(sdkDirs) {
+		tc, ok := cache.toolchainAt(p, seen)
+		if ok {
+			tcs = append(tcs, tc)
+		}
+	}
+	return tcs
+}
+
+// SelectToolchain returns the first toolchain found by FindToolchains
+// which satisfies the min version. If min is empty, the first toolchain
+// found is returned.
+func SelectToolchain(min string, sdkDirs []string) (Toolchain, error) {
+	return selectToolchain(min, sdkDirs, "")
+}
+
+// selectToolchain is SelectToolchain, caching the toolchain versions at
+// cachePath if it's not empty. See toolchainCache.
+func selectToolchain(min string, sdkDirs []string,
+	cachePath string) (Toolchain, error) {
+	cache := loadToolchainCache(cachePath)
+	defer cache.save()
+
+	var found []Toolchain
+	seen := map[string]bool{}
+	for _, p := range toolchainCandidates(sdkDirs) {
+		tc, ok := cache.toolchainAt(p, seen)
+		if !ok {
+			continue
+		}
+		if min == "" || compareGoVersions(tc.Version, min) >= 0 {
+			return tc, nil
+		}
+		found = append(found, tc)
+	}
+	return Toolchain{}, &ToolchainError{Required: min, Found: found}
+}
+
+// ParseGoDirective returns the highest go version declared by the
+// `// gos:go <version>` directive in the given sources, or an empty
+// string if none of them declare it.
+func ParseGoDirective(srcs []string) (string, error) {
+	var min string
+	for _, src := range srcs {
+		v, err := parseGoDirective(src)
+		if err != nil {
+			return "", err
+		}
+		if v != "" && (min == "" || compareGoVersions(v, min) > 0) {
+			min = v
+		}
+	}
+	return min, nil
+}
+
+// parseGoDirective returns the go directive version of a single source.
+func parseGoDirective(src string) (string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if !strings.HasPrefix(l, "//") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(l, "//"))
+		if len(fields) == 2 && fields[0] == goDirective {
+			return fields[1], nil
+		}
+	}
+	return "", s.Err()
+}
+
+// scriptToolchain selects the toolchain for the given sources, based on
+// their go directive. The toolchain versions are cached in opts.Temp.
+func scriptToolchain(srcs []string, opts ScriptOptions) (Toolchain, error) {
+	min, err := ParseGoDirective(srcs)
+	if err != nil {
+		return Toolchain{}, err
+	}
+	return selectToolchain(min, opts.SDKDirs, toolchainCachePath(opts.Temp))
+}
+
+// dirSources returns the non-test go files within dir.
+func dirSources(dir string) ([]string, error) {
+	srcs, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	var nonTest []string
+	for _, src := range srcs {
+		if !strings.HasSuffix(src, "_test.go") {
+			nonTest = append(nonTest, src)
+		}
+	}
+	return nonTest, nil
+}
+
+// toolchainCandidates returns the paths of go commands that may be
+// toolchains, in order of preference.
+func toolchainCandidates(sdkDirs []string) []string {
+	var ps []string
+	if root := os.Getenv("GOROOT"); root != "" {
+		ps = append(ps, filepath.Join(root, "bin", "go"))
+	}
+	if p, err := exec.LookPath("go"); err == nil {
+		ps = append(ps, p)
+	}
+
+	for _, dir := range sdkDirs {
+		goCmd := filepath.Join(dir, "bin", "go")
+		if exists, _, _ := utils.Exists(goCmd); exists {
+			ps = append(ps, goCmd)
+			continue
+		}
+
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		// Prefer the newest toolchains of the sdk dir.
+		sort.Slice(fis, func(i, j int) bool {
+			return compareGoVersions(fis[i].Name(), fis[j].Name()) > 0
+		})
+		for _, fi := range fis {
+			goCmd := filepath.Join(dir, fi.Name(), "bin", "go")
+			if exists, _, _ := utils.Exists(goCmd); exists {
+				ps = append(ps, goCmd)
+			}
+		}
+	}
+	return ps
+}
+
+// toolchainCache is the version of each go command found, keyed by its
+// real path. It's stored in the Temp dir, so that runs of a cached script
+// don't need to run each go command to find its version again.
+type toolchainCache struct {
+	// The path the cache is stored at. If empty, nothing is cached.
+	path string
+
+	entries map[string]toolchainEntry
+	changed bool
+}
+
+// toolchainEntry is the cached version of a go command. It's only used
+// while the size and mod time of the command are unchanged.
+type toolchainEntry struct {
+	Version string
+	Size    int64
+	ModTime time.Time
+}
+
+// toolchainCachePath returns the toolchain cache path for the temp dir.
+// Without a temp dir, nothing is cached.
+func toolchainCachePath(temp string) string {
+	if temp == "" {
+		return ""
+	}
+	return filepath.Join(temp, "toolchains.json")
+}
+
+// loadToolchainCache loads the toolchain cache stored at p. A missing or
+// invalid cache is empty.
+func loadToolchainCache(p string) *toolchainCache {
+	c := &toolchainCache{path: p, entries: map[string]toolchainEntry{}}
+	if p == "" {
+		return c
+	}
+	if b, err := ioutil.ReadFile(p); err == nil {
+		if json.Unmarshal(b, &c.entries) != nil {
+			c.entries = map[string]toolchainEntry{}
+		}
+	}
+	return c
+}
+
+// save stores the cache, if it has changed since it was loaded. The
+// cache is only an optimisation, so failing to store it is ignored.
+func (c *toolchainCache) save() {
+	if c.path == "" || !c.changed {
+		return
+	}
+	b, err := json.Marshal(c.entries)
+	if err != nil {
+		return
+	}
+
+	// Concurrent runs may save at the same time, so the cache is written
+	// beside its path and then renamed over it, rather than truncated.
+	if err := os.MkdirAll(filepath.Dir(c.path), 0777); err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(filepath.Dir(c.path), ".toolchains")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// toolchainAt returns the toolchain of the given go command, unless it
+// is in seen or is not a usable toolchain.
+func (c *toolchainCache) toolchainAt(goCmd string,
+	seen map[string]bool) (Toolchain, bool) {
+	real, err := filepath.EvalSymlinks(goCmd)
+	if err != nil || seen[real] {
+		return Toolchain{}, false
+	}
+	seen[real] = true
+
+	v, err := c.version(real)
+	if err != nil {
+		return Toolchain{}, false
+	}
+	return Toolchain{Go: goCmd, Version: v}, true
+}
+
+// version returns the version of the go command at the real path, from
+// the cache if the command is unchanged.
+func (c *toolchainCache) version(real string) (string, error) {
+	fi, err := os.Stat(real)
+	if err != nil {
+		return "", err
+	}
+	e, ok := c.entries[real]
+	if ok && e.Size == fi.Size() && e.ModTime.Equal(fi.ModTime()) {
+		return e.Version, nil
+	}
+
+	v, err := toolchainVersion(real)
+	if err != nil {
+		return "", err
+	}
+	c.entries[real] = toolchainEntry{
+		Version: v, Size: fi.Size(), ModTime: fi.ModTime(),
+	}
+	c.changed = true
+	return v, nil
+}
+
+// toolchainVersion returns the version of the given go command. The
+// VERSION file of its GOROOT is preferred, as it avoids running go.
+func toolchainVersion(goCmd string) (string, error) {
+	root := filepath.Dir(filepath.Dir(goCmd))
+	if b, err := ioutil.ReadFile(filepath.Join(root, "VERSION")); err == nil {
+		if v := strings.Fields(string(b)); len(v) > 0 {
+			return v[0], nil
+		}
+	}
+
+	// Eg: go version go1.22.3 linux/amd64
+	b, err := exec.Command(goCmd, "version").Output()
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 3 {
+		return "", fmt.Errorf("Unexpected go version output: %q", b)
+	}
+	return fields[2], nil
+}
+
+// compareGoVersions compares two go versions, such as "1.22" and
+// "go1.22.3", returning -1, 0 or 1. Prereleases sort before the release
+// they precede.
+func compareGoVersions(a, b string) int {
+	an, apre := parseGoVersion(a)
+	bn, bpre := parseGoVersion(b)
+	for i := range an {
+		if an[i] != bn[i] {
+			if an[i] < bn[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case apre == bpre:
+		return 0
+	case apre == "":
+		return 1
+	case bpre == "":
+		return -1
+	case apre < bpre:
+		return -1
+	}
+	return 1
+}
+
+// parseGoVersion splits a go version into its major, minor and patch
+// numbers and any prerelease suffix, such as "rc1".
+func parseGoVersion(v string) (n [3]int, pre string) {
+	v = strings.TrimPrefix(v, "go")
+	for i := range n {
+		end := strings.IndexFunc(v, func(r rune) bool {
+			return r < '0' || r > '9'
+		})
+		if end == -1 {
+			end = len(v)
+		}
+		n[i], _ = strconv.Atoi(v[:end])
+		v = v[end:]
+		if !strings.HasPrefix(v, ".") {
+			break
+		}
+		v = v[1:]
+	}
+	return n, v
+}
@@ -0,0 +1,134 @@
+package goscriptify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompareGoVersions(t *testing.T) {
+	Convey("Should compare go versions", t, func() {
+		So(compareGoVersions("go1.22.3", "1.22"), ShouldEqual, 1)
+		So(compareGoVersions("go1.22.0", "1.22"), ShouldEqual, 0)
+		So(compareGoVersions("go1.21.9", "1.22"), ShouldEqual, -1)
+		So(compareGoVersions("go1.9", "go1.10"), ShouldEqual, -1)
+	})
+
+	Convey("Should sort prereleases before their release", t, func() {
+		So(compareGoVersions("go1.22rc1", "go1.22"), ShouldEqual, -1)
+		So(compareGoVersions("go1.22rc1", "go1.22rc2"), ShouldEqual, -1)
+		So(compareGoVersions("go1.22rc1", "go1.21.5"), ShouldEqual, 1)
+	})
+}
+
+func TestParseGoDirective(t *testing.T) {
+	fixDir := filepath.Join("_test", "fixtures")
+
+	Convey("Should return the directive version", t, func() {
+		v, err := ParseGoDirective([]string{
+			filepath.Join(fixDir, "exit15.go"),
+			filepath.Join(fixDir, "gorequire.go"),
+		})
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "1.99")
+	})
+
+	Convey("Should return nothing without a directive", t, func() {
+		v, err := ParseGoDirective([]string{filepath.Join(fixDir, "exit15.go")})
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "")
+	})
+}
+
+func TestSelectToolchain(t *testing.T) {
+	sdkDir := filepath.Join("_test", "fixtures", "sdk")
+
+	Convey("Should select the default toolchain without a version", t, func() {
+		tc, err := SelectToolchain("", nil)
+		So(err, ShouldBeNil)
+		So(tc.Version, ShouldStartWith, "go1.")
+	})
+
+	Convey("Should select a toolchain from the sdk dirs", t, func() {
+		tc, err := SelectToolchain("1.99", []string{sdkDir})
+		So(err, ShouldBeNil)
+		So(tc.Version, ShouldEqual, "go1.99.0")
+		So(tc.Go, ShouldEqual, filepath.Join(sdkDir, "go1.99.0", "bin", "go"))
+	})
+
+	Convey("Should return a ToolchainError if none are suitable", t, func() {
+		_, err := SelectToolchain("1.100", []string{sdkDir})
+		tcErr, ok := err.(*ToolchainError)
+		So(ok, ShouldBeTrue)
+		So(tcErr.Required, ShouldEqual, "1.100")
+
+		// The toolchains of the host come first, and vary.
+		n := len(tcErr.Found)
+		So(n, ShouldBeGreaterThanOrEqualTo, 2)
+		So(tcErr.Found[n-2:], ShouldResemble, []Toolchain{
+			{
+				Go:      filepath.Join(sdkDir, "go1.99.0", "bin", "go"),
+				Version: "go1.99.0",
+			},
+			{
+				Go:      filepath.Join(sdkDir, "go1.98.0", "bin", "go"),
+				Version: "go1.98.0",
+			},
+		})
+	})
+}
+
+func TestToolchainCache(t *testing.T) {
+	Convey("Should only run changed go commands", t, func() {
+		sdkDir, err := ioutil.TempDir("", "goscriptify-sdk")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(sdkDir)
+
+		// The go command counts how often it's run, in its sdk dir.
+		calls := filepath.Join(sdkDir, "calls")
+		goCmd := filepath.Join(sdkDir, "go1.97.0", "bin", "go")
+		So(os.MkdirAll(filepath.Dir(goCmd), 0777), ShouldBeNil)
+		So(ioutil.WriteFile(goCmd, []byte("#!/usr/bin/env bash\n"+
+			"echo run >> "+calls+"\n"+
+			"echo go version go1.97.0 linux/amd64\n"), 0777), ShouldBeNil)
+		runs := func() int {
+			b, _ := ioutil.ReadFile(calls)
+			return strings.Count(string(b), "run")
+		}
+
+		cachePath := filepath.Join(sdkDir, "toolchains.json")
+		for i := 0; i < 2; i++ {
+			tc, err := selectToolchain("1.97", []string{sdkDir}, cachePath)
+			So(err, ShouldBeNil)
+			So(tc.Version, ShouldEqual, "go1.97.0")
+		}
+		So(runs(), ShouldEqual, 1)
+
+		later := time.Now().Add(time.Hour)
+		So(os.Chtimes(goCmd, later, later), ShouldBeNil)
+		_, err = selectToolchain("1.97", []string{sdkDir}, cachePath)
+		So(err, ShouldBeNil)
+		So(runs(), ShouldEqual, 2)
+
+		_, err = selectToolchain("1.97", []string{sdkDir}, "")
+		So(err, ShouldBeNil)
+		So(runs(), ShouldEqual, 3)
+	})
+}
+
+func TestRunScriptsToolchain(t *testing.T) {
+	Convey("Should not build scripts requiring a missing toolchain", t, func() {
+		src := filepath.Join("_test", "fixtures", "gorequire.go")
+		_, err := RunScriptsWithOpts([]string{src}, []string{}, ScriptOptions{
+			Temp:  filepath.Join("_test", "tmp"),
+			Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+		})
+		_, ok := err.(*ToolchainError)
+		So(ok, ShouldBeTrue)
+	})
+}
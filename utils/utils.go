@@ -32,6 +32,24 @@ func HashString(s string) string {
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
+// HashFiles hashes the names and contents of the given files.
+func HashFiles(ps []string) (string, error) {
+	h := md5.New()
+	for _, p := range ps {
+		f, err := os.Open(p)
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, p)
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
 // Exists returns whether the path exists or not, and if it is a directory
 // or not.
 func Exists(p string) (exists bool, isDir bool, err error) {
@@ -44,3 +62,16 @@ func Exists(p string) (exists bool, isDir bool, err error) {
 	}
 	return true, fi.IsDir(), nil
 }
+
+// IsTerminal returns whether the given writer is a terminal.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
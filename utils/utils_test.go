@@ -73,3 +73,35 @@ func TestExists(t *testing.T) {
 		So(isDir, ShouldBeFalse)
 	})
 }
+
+func TestIsTerminal(t *testing.T) {
+	Convey("Should not consider non-files terminals", t, func() {
+		So(IsTerminal(ioutil.Discard), ShouldBeFalse)
+	})
+
+	Convey("Should not consider regular files terminals", t, func() {
+		f, err := os.Open(filepath.Join("..", "_test", "fixtures", "foo"))
+		So(err, ShouldBeNil)
+		defer f.Close()
+		So(IsTerminal(f), ShouldBeFalse)
+	})
+}
+
+func TestHashFiles(t *testing.T) {
+	fixDir := filepath.Join("..", "_test", "fixtures")
+
+	Convey("Should hash the file names and contents", t, func() {
+		foo, err := HashFiles([]string{filepath.Join(fixDir, "foo")})
+		So(err, ShouldBeNil)
+		bar, err := HashFiles([]string{filepath.Join(fixDir, "bar")})
+		So(err, ShouldBeNil)
+		So(foo, ShouldNotEqual, bar)
+		again, _ := HashFiles([]string{filepath.Join(fixDir, "foo")})
+		So(again, ShouldEqual, foo)
+	})
+
+	Convey("Should return an error for missing files", t, func() {
+		_, err := HashFiles([]string{filepath.Join(fixDir, "idontexist")})
+		So(err, ShouldNotBeNil)
+	})
+}
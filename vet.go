@@ -0,0 +1,337 @@
+package goscriptify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/leeola/goscriptify/utils"
+)
+
+// VetMode controls whether scripts are vetted before they are run.
+type VetMode int
+
+const (
+	// VetOff does not vet scripts.
+	VetOff VetMode = iota
+
+	// VetWarn prints any vet diagnostics to the Stderr, but still runs
+	// the script.
+	VetWarn
+
+	// VetFail returns a VetError rather than running the script, if vet
+	// reports any diagnostics.
+	VetFail
+)
+
+// VetDiagnostic is a single problem reported by a vet analyzer.
+type VetDiagnostic struct {
+	// The analyzer reporting the problem, eg "printf".
+	Analyzer string
+
+	// The position of the problem, as file:line:col
+	Pos string
+
+	Message string
+}
+
+func (d VetDiagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Analyzer)
+}
+
+// VetError is returned when vet reports problems with a script and
+// ScriptOptions.Vet is VetFail.
+type VetError struct {
+	Diagnostics []VetDiagnostic
+}
+
+func (e *VetError) Error() string {
+	return fmt.Sprintf("Go vet error:\n\n%s", formatVetDiagnostics(e.Diagnostics))
+}
+
+// VetFiles runs go vet with the given vet flags, eg "-printf", on the
+// given sources and returns the reported diagnostics.
+func VetFiles(ctx context.Context, srcs []string, vetFlags []string,
+	opts BuildOptions) ([]VetDiagnostic, error) {
+	args := append([]string{"vet", "-json"}, vetFlags...)
+	return goVet(ctx, "", append(args, srcs...), opts)
+}
+
+// VetDir runs go vet with the given vet flags, eg "-printf", on the
+// package in dir and returns the reported diagnostics.
+func VetDir(ctx context.Context, dir string, vetFlags []string,
+	opts BuildOptions) ([]VetDiagnostic, error) {
+	args := append([]string{"vet", "-json"}, vetFlags...)
+	return goVet(ctx, dir, append(args, "."), opts)
+}
+
+// goVet runs go vet with the given args, and decodes its json output.
+func goVet(ctx context.Context, dir string, args []string,
+	opts BuildOptions) ([]VetDiagnostic, error) {
+	// Depending on the Go version, vet writes its json to either the
+	// stdout or stderr, so both are decoded.
+	var stdout, stderr bytes.Buffer
+	err := runGo(ctx, "vet", dir, args, opts, &stdout, &stderr)
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("Go vet failed:\n\n%s", stderr.String())
+		}
+		return nil, err
+	}
+
+	var ds []VetDiagnostic
+	for _, out := range []*bytes.Buffer{&stdout, &stderr} {
+		d, err := decodeVetJSON(out)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d...)
+	}
+	return ds, nil
+}
+
+// decodeVetJSON decodes the diagnostics from the output of go vet -json,
+// which is a json object per package, separated by "# pkg" comments.
+//
+// Analyzers which fail report an error object rather than diagnostics.
+// If any do, an error listing them is returned, as the package may
+// otherwise appear to have vetted clean.
+func decodeVetJSON(r io.Reader) ([]VetDiagnostic, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, l := range strings.Split(string(b), "\n") {
+		if !strings.HasPrefix(l, "#") {
+			lines = append(lines, l)
+		}
+	}
+
+	var ds []VetDiagnostic
+	var failures []string
+	dec := json.NewDecoder(strings.NewReader(strings.Join(lines, "\n")))
+	for {
+		// package -> analyzer -> diagnostics, or an error object
+		var pkgs map[string]map[string]json.RawMessage
+		err := dec.Decode(&pkgs)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for pkg, analyzers := range pkgs {
+			for name, raw := range analyzers {
+				var diags []struct {
+					Posn    string `json:"posn"`
+					Message string `json:"message"`
+				}
+				if err := json.Unmarshal(raw, &diags); err == nil {
+					for _, d := range diags {
+						ds = append(ds, VetDiagnostic{
+							Analyzer: name,
+							Pos:      d.Posn,
+							Message:  d.Message,
+						})
+					}
+					continue
+				}
+
+				msg, err := vetErrorMessage(raw)
+				if err != nil {
+					return nil, err
+				}
+				failures = append(failures,
+					fmt.Sprintf("%s: %s: %s", pkg, name, msg))
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return nil, fmt.Errorf("Go vet failed:\n\n%s",
+			strings.Join(failures, "\n"))
+	}
+	return ds, nil
+}
+
+// vetErrorMessage returns the message of an analyzer error object, eg
+// {"error": "msg"}. The error of a package, which is reported as the
+// "error" analyzer, is a plain string.
+func vetErrorMessage(raw json.RawMessage) (string, error) {
+	var msg string
+	if json.Unmarshal(raw, &msg) == nil {
+		return msg, nil
+	}
+
+	var obj struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return "", fmt.Errorf("Unexpected go vet output: %s", raw)
+	}
+	return obj.Error, nil
+}
+
+// vetCache is the cached vet result of a script, stored in the Temp dir
+// next to the script bin.
+type vetCache struct {
+	// Key is a hash of the vetted source contents, toolchain and flags.
+	Key string
+
+	Diagnostics []VetDiagnostic
+}
+
+// cachedVet returns the diagnostics cached at p for key, or calls vet
+// and caches its diagnostics if there are none.
+func cachedVet(p, key string, vet func() ([]VetDiagnostic,
+	error)) ([]VetDiagnostic, error) {
+	var c vetCache
+	if b, err := ioutil.ReadFile(p); err == nil {
+		if json.Unmarshal(b, &c) == nil && c.Key == key {
+			return c.Diagnostics, nil
+		}
+	}
+
+	ds, err := vet()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(vetCache{Key: key, Diagnostics: ds})
+	if err != nil {
+		return nil, err
+	}
+	return ds, ioutil.WriteFile(p, b, 0666)
+}
+
+// vetKey returns the vet cache key of the given sources.
+func vetKey(srcs []string, tc Toolchain, vetFlags []string) (string, error) {
+	h, err := utils.HashFiles(srcs)
+	if err != nil {
+		return "", err
+	}
+	return utils.HashString(strings.Join(
+		append([]string{h, tc.Version}, vetFlags...), "\x00")), nil
+}
+
+// vetScripts vets the given script paths according to opts.Vet, caching
+// the result at cachePath. Diagnostics are reported against the original
+// script paths, rather than the generated ones.
+func vetScripts(ctx context.Context, cachePath string, ps []ScriptPath,
+	tc Toolchain, opts ScriptOptions) error {
+	if opts.Vet == VetOff {
+		return nil
+	}
+
+	srcs := make([]string, len(ps))
+	for i, s := range ps {
+		srcs[i] = s.Generated
+	}
+
+	key, err := vetKey(srcs, tc, opts.VetFlags)
+	if err != nil {
+		return err
+	}
+
+	ds, err := cachedVet(cachePath, key, func() ([]VetDiagnostic, error) {
+		ds, err := VetFiles(ctx, srcs, opts.VetFlags, opts.buildOptions(tc))
+		if err != nil {
+			return nil, err
+		}
+		return originalVetPositions(ds, ps), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return reportVet(ds, opts)
+}
+
+// vetDir vets the given script dir according to opts.Vet, caching the
+// result at cachePath.
+func vetDir(ctx context.Context, cachePath, dir string, srcs []string,
+	tc Toolchain, opts ScriptOptions) error {
+	if opts.Vet == VetOff {
+		return nil
+	}
+
+	key, err := vetKey(srcs, tc, opts.VetFlags)
+	if err != nil {
+		return err
+	}
+
+	ds, err := cachedVet(cachePath, key, func() ([]VetDiagnostic, error) {
+		return VetDir(ctx, dir, opts.VetFlags, opts.buildOptions(tc))
+	})
+	if err != nil {
+		return err
+	}
+
+	return reportVet(ds, opts)
+}
+
+// reportVet fails or warns about the given diagnostics, based on the
+// opts.Vet mode.
+func reportVet(ds []VetDiagnostic, opts ScriptOptions) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	if opts.Vet == VetFail {
+		return &VetError{Diagnostics: ds}
+	}
+	if opts.Stderr != nil {
+		fmt.Fprintf(opts.Stderr, "Go vet warning:\n\n%s\n",
+			formatVetDiagnostics(ds))
+	}
+	return nil
+}
+
+// originalVetPositions replaces the generated script paths within the
+// diagnostic positions with their original script paths.
+func originalVetPositions(ds []VetDiagnostic, ps []ScriptPath) []VetDiagnostic {
+	for i, d := range ds {
+		ds[i].Pos = originalPos(d.Pos, ps)
+	}
+	return ds
+}
+
+// originalPos replaces the generated script path of a file:line:col
+// position with its original script path.
+func originalPos(pos string, ps []ScriptPath) string {
+	for _, s := range ps {
+		gen := []string{s.Generated}
+		if abs, err := filepath.Abs(s.Generated); err == nil {
+			gen = append(gen, abs)
+		}
+		for _, g := range gen {
+			if strings.HasPrefix(pos, g+":") {
+				return s.Original + strings.TrimPrefix(pos, g)
+			}
+		}
+	}
+	return pos
+}
+
+func formatVetDiagnostics(ds []VetDiagnostic) string {
+	lines := make([]string, len(ds))
+	for i, d := range ds {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// vetCachePath returns the vet cache path for the given bin.
+func vetCachePath(binDst string) string {
+	return binDst + ".vet"
+}
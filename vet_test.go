@@ -0,0 +1,162 @@
+package goscriptify
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVet(t *testing.T) {
+	fixDir := filepath.Join("_test", "fixtures")
+
+	vets := []struct {
+		name string
+		vet  func(vetFlags []string) ([]VetDiagnostic, error)
+	}{
+		{"files", func(vetFlags []string) ([]VetDiagnostic, error) {
+			return VetFiles(context.Background(),
+				[]string{filepath.Join(fixDir, "vet.go")}, vetFlags,
+				BuildOptions{})
+		}},
+		{"dir", func(vetFlags []string) ([]VetDiagnostic, error) {
+			return VetDir(context.Background(),
+				filepath.Join(fixDir, "vet_dir"), vetFlags, BuildOptions{})
+		}},
+	}
+
+	for _, v := range vets {
+		Convey("Should return vet diagnostics of "+v.name, t, func() {
+			ds, err := v.vet(nil)
+			So(err, ShouldBeNil)
+			So(len(ds), ShouldEqual, 1)
+			So(ds[0].Analyzer, ShouldEqual, "printf")
+			So(ds[0].Pos, ShouldContainSubstring, "vet.go:9:")
+		})
+
+		Convey("Should only run the given analyzers of "+v.name, t, func() {
+			ds, err := v.vet([]string{"-copylocks"})
+			So(err, ShouldBeNil)
+			So(len(ds), ShouldEqual, 0)
+		})
+	}
+}
+
+func TestDecodeVetJSON(t *testing.T) {
+	Convey("Should decode the diagnostics of each package", t, func() {
+		ds, err := decodeVetJSON(strings.NewReader("# a\n" +
+			`{"a": {"printf": [{"posn": "a.go:1:2", "message": "bad"}]}}` +
+			"\n# b\n" + `{"b": {}}`))
+		So(err, ShouldBeNil)
+		So(ds, ShouldResemble, []VetDiagnostic{
+			{Analyzer: "printf", Pos: "a.go:1:2", Message: "bad"},
+		})
+	})
+
+	Convey("Should return an error for failed analyzers", t, func() {
+		_, err := decodeVetJSON(strings.NewReader(
+			`{"a": {"printf": [], "copylocks": {"error": "failed"}}}`))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual,
+			"Go vet failed:\n\na: copylocks: failed")
+	})
+
+	Convey("Should return an error for failed packages", t, func() {
+		_, err := decodeVetJSON(strings.NewReader(
+			`{"a": {"error": "type error"}}`))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "Go vet failed:\n\na: error: type error")
+	})
+}
+
+func TestCachedVet(t *testing.T) {
+	p := filepath.Join("_test", "tmp", "cachedvet")
+	os.Remove(p)
+
+	Convey("Should only vet once per key", t, func() {
+		calls := 0
+		vet := func() ([]VetDiagnostic, error) {
+			calls++
+			return []VetDiagnostic{{Analyzer: "printf"}}, nil
+		}
+
+		ds, err := cachedVet(p, "foo", vet)
+		So(err, ShouldBeNil)
+		So(len(ds), ShouldEqual, 1)
+		ds, err = cachedVet(p, "foo", vet)
+		So(err, ShouldBeNil)
+		So(len(ds), ShouldEqual, 1)
+		So(ds[0].Analyzer, ShouldEqual, "printf")
+		So(calls, ShouldEqual, 1)
+
+		_, err = cachedVet(p, "bar", vet)
+		So(err, ShouldBeNil)
+		So(calls, ShouldEqual, 2)
+	})
+}
+
+func TestRunScriptsVet(t *testing.T) {
+	fixDir := filepath.Join("_test", "fixtures")
+	tmpDir := filepath.Join("_test", "tmp")
+
+	// Diagnostics are reported against the original script, and go vet
+	// reports the files of dirs by their absolute path.
+	vetDir, err := filepath.Abs(filepath.Join(fixDir, "vet_dir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scripts := []struct {
+		name string
+		src  string
+		pos  string
+		run  func(src string, opts ScriptOptions) (int, error)
+	}{
+		{"a no-ext script", filepath.Join(fixDir, "vet"),
+			filepath.Join(fixDir, "vet") + ":9:",
+			func(src string, opts ScriptOptions) (int, error) {
+				return RunScriptsWithOpts([]string{src}, []string{}, opts)
+			}},
+		{"a .go script", filepath.Join(fixDir, "vet.go"),
+			filepath.Join(fixDir, "vet.go") + ":9:",
+			func(src string, opts ScriptOptions) (int, error) {
+				return RunScriptsWithOpts([]string{src}, []string{}, opts)
+			}},
+		{"a script dir", vetDir, filepath.Join(vetDir, "vet.go") + ":9:",
+			func(src string, opts ScriptOptions) (int, error) {
+				return RunScriptDirWithOpts(src, []string{}, opts)
+			}},
+	}
+
+	for _, s := range scripts {
+		Convey("Should return a VetError against "+s.name, t, func() {
+			_, err := s.run(s.src, ScriptOptions{
+				Temp:  tmpDir,
+				Stdin: nil, Stdout: ioutil.Discard, Stderr: ioutil.Discard,
+				Vet: VetFail,
+			})
+			vetErr, ok := err.(*VetError)
+			So(ok, ShouldBeTrue)
+			So(len(vetErr.Diagnostics), ShouldEqual, 1)
+			So(vetErr.Diagnostics[0].Analyzer, ShouldEqual, "printf")
+			So(vetErr.Diagnostics[0].Pos, ShouldStartWith, s.pos)
+		})
+
+		Convey("Should warn and run "+s.name, t, func() {
+			var stderr bytes.Buffer
+			exit, err := s.run(s.src, ScriptOptions{
+				Temp:  tmpDir,
+				Stdin: nil, Stdout: ioutil.Discard, Stderr: &stderr,
+				Vet: VetWarn,
+			})
+			So(err, ShouldBeNil)
+			So(exit, ShouldEqual, 15)
+			So(stderr.String(), ShouldContainSubstring, "Go vet warning")
+		})
+	}
+}
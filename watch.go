@@ -0,0 +1,258 @@
+package goscriptify
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/leeola/goscriptify/utils"
+)
+
+// DefaultWatchInterval is how often the sources of a watched script are
+// checked for changes.
+const DefaultWatchInterval = 250 * time.Millisecond
+
+// DefaultWatchDebounce is how long the sources of a watched script must
+// be unchanged before it's restarted.
+const DefaultWatchDebounce = 100 * time.Millisecond
+
+// fileState is the state of a watched file, which changes whenever the
+// file is written.
+type fileState struct {
+	ModTime time.Time
+	Size    int64
+}
+
+// sourceState is the state of each existing watched file.
+type sourceState map[string]fileState
+
+func (s sourceState) equal(o sourceState) bool {
+	if len(s) != len(o) {
+		return false
+	}
+	for p, fs := range s {
+		ofs, ok := o[p]
+		if !ok || !fs.ModTime.Equal(ofs.ModTime) || fs.Size != ofs.Size {
+			return false
+		}
+	}
+	return true
+}
+
+// statSources returns the state of the given files. Missing files are
+// left out, so that their creation is seen as a change.
+func statSources(ps []string) sourceState {
+	s := sourceState{}
+	for _, p := range ps {
+		if fi, err := os.Stat(p); err == nil {
+			s[p] = fileState{ModTime: fi.ModTime(), Size: fi.Size()}
+		}
+	}
+	return s
+}
+
+// WatchScripts copies, compiles and runs the given scripts, and then
+// rebuilds and restarts them whenever they change, until ctx is done.
+//
+// A running script is stopped as when its context is cancelled, with
+// SIGTERM and then SIGKILL after opts.GracePeriod. Build failures, and
+// the exit status of scripts that exit by themselves, are printed to
+// opts.Stderr while waiting for the next change.
+//
+// WatchScripts returns the ctx error, once ctx is done and the script
+// has stopped.
+func WatchScripts(ctx context.Context, scripts, args []string,
+	opts ScriptOptions) error {
+	sources := func() sourceState {
+		return statSources(scripts)
+	}
+	start := func(ctx context.Context) (*Process, error) {
+		return startScripts(ctx, scripts, args, opts, false)
+	}
+	return watch(ctx, sources, start, opts)
+}
+
+// WatchScriptDir compiles and runs the given go package directory, and
+// then rebuilds and restarts it whenever the files of the package
+// change, until ctx is done. See WatchScripts.
+//
+// Other files in the directory, such as those written by the script, are
+// ignored. With opts.Generate however every file of the directory may
+// be an input of its generators, and so is watched, as it is when
+// deciding whether to generate.
+func WatchScriptDir(ctx context.Context, dir string, args []string,
+	opts ScriptOptions) error {
+	sources := func() sourceState {
+		if opts.Generate {
+			ps, _ := dirFiles(dir)
+			return statSources(ps)
+		}
+		return statSources(packageFiles(dir))
+	}
+	start := func(ctx context.Context) (*Process, error) {
+		return startScriptDir(ctx, dir, args, opts, false)
+	}
+	return watch(ctx, sources, start, opts)
+}
+
+// packageFiles returns the files of the go package dir which are used to
+// build it, including its go.mod and embedded files. If the package
+// cannot be read, all of its go files are returned.
+func packageFiles(dir string) []string {
+	pkg, err := build.ImportDir(dir, 0)
+	if err != nil && pkg == nil {
+		ps, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+		return ps
+	}
+
+	var names []string
+	for _, fs := range [][]string{
+		pkg.GoFiles, pkg.CgoFiles, pkg.IgnoredGoFiles, pkg.InvalidGoFiles,
+		pkg.CFiles, pkg.CXXFiles, pkg.MFiles, pkg.HFiles, pkg.FFiles,
+		pkg.SFiles, pkg.SwigFiles, pkg.SwigCXXFiles, pkg.SysoFiles,
+		{"go.mod", "go.sum"},
+	} {
+		names = append(names, fs...)
+	}
+
+	ps := make([]string, 0, len(names))
+	for _, name := range names {
+		ps = append(ps, filepath.Join(dir, name))
+	}
+
+	// Embed patterns may match dirs, whose files are all embedded.
+	for _, pattern := range pkg.EmbedPatterns {
+		pattern = strings.TrimPrefix(pattern, "all:")
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		for _, m := range matches {
+			walkDirFiles(m, func(p string, fi os.FileInfo) {
+				ps = append(ps, p)
+			})
+		}
+	}
+	return ps
+}
+
+// watch starts the script, and restarts it whenever its sources change,
+// until ctx is done.
+//
+// The sources are checked once the script has been built, so that files
+// written by the build, such as by go:generate, are not seen as changes.
+//
+// Each run is given a context which is cancelled to restart it, and so
+// would otherwise be started in its own process group. If Stdin is our
+// terminal, the script is instead kept in our group, so that it remains
+// in the foreground and can read from the terminal.
+func watch(ctx context.Context, sources func() sourceState,
+	start func(context.Context) (*Process, error), opts ScriptOptions) error {
+	stderr := opts.Stderr
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	stdin, _ := opts.Stdin.(*os.File)
+	foreground := stdin != nil && utils.IsTerminal(stdin)
+
+	for {
+		runCtx, stop := context.WithCancel(ctx)
+		if foreground {
+			runCtx = withoutGroup(runCtx)
+		}
+		proc, err := start(runCtx)
+		if err != nil && ctx.Err() == nil {
+			reportWatchError(stderr, err)
+		}
+		state := sources()
+
+		changed := waitForChange(ctx, proc, state, sources, opts, stderr)
+
+		stop()
+		if proc != nil {
+			proc.Wait()
+		}
+		if !changed {
+			return ctx.Err()
+		}
+
+		fmt.Fprintln(stderr, "goscriptify: sources changed, restarting")
+	}
+}
+
+// waitForChange polls the sources until they differ from state, and
+// then remain unchanged for the debounce period. If the process, which
+// is nil if it failed to start, exits meanwhile its exit status is
+// printed to stderr.
+//
+// It returns false if ctx was done before a change.
+func waitForChange(ctx context.Context, proc *Process, state sourceState,
+	sources func() sourceState, opts ScriptOptions, stderr io.Writer) bool {
+	var exited <-chan struct{}
+	if proc != nil {
+		exited = proc.Done()
+	}
+
+	interval := opts.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	debounce := opts.WatchDebounce
+	if debounce <= 0 {
+		debounce = DefaultWatchDebounce
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+
+		case <-exited:
+			exited = nil
+			res, err := proc.Wait()
+			if err != nil {
+				reportWatchError(stderr, err)
+			} else {
+				fmt.Fprintf(stderr, "goscriptify: script exited with "+
+					"status %d, waiting for changes\n", res.Status())
+			}
+
+		case <-t.C:
+			cur := sources()
+			if cur.equal(state) {
+				continue
+			}
+
+			// Wait for a burst of edits to settle.
+			for {
+				select {
+				case <-ctx.Done():
+					return false
+				case <-time.After(debounce):
+				}
+
+				next := sources()
+				if next.equal(cur) {
+					return true
+				}
+				cur = next
+			}
+		}
+	}
+}
+
+// reportWatchError prints an error building or running a watched
+// script.
+func reportWatchError(w io.Writer, err error) {
+	if builderr, ok := err.(*BuildError); ok {
+		fmt.Fprint(w, builderr.Error())
+		return
+	}
+	fmt.Fprintf(w, "goscriptify: %s\n", err)
+}
@@ -0,0 +1,158 @@
+package goscriptify
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes and reads.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitForOutput waits for the buffer to contain s, returning false if it
+// does not within a timeout.
+func waitForOutput(b *syncBuffer, s string) bool {
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		if strings.Contains(b.String(), s) {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+const watchScript = `package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func main() {
+	fmt.Println(%q)
+	time.Sleep(time.Hour)
+}
+`
+
+func TestWatchScripts(t *testing.T) {
+	tmpDir := filepath.Join("_test", "tmp")
+	src := filepath.Join(tmpDir, "watch-script.go")
+	write := func(msg string) {
+		s := strings.Replace(watchScript, "%q", `"`+msg+`"`, 1)
+		ioutil.WriteFile(src, []byte(s), 0644)
+	}
+	os.MkdirAll(tmpDir, 0777)
+	defer os.Remove(src)
+
+	Convey("Should restart the script when it changes", t, func() {
+		write("one")
+		var stdout, stderr syncBuffer
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- WatchScripts(ctx, []string{src}, []string{}, ScriptOptions{
+				Temp: tmpDir, Stdout: &stdout, Stderr: &stderr,
+				GracePeriod:   time.Second,
+				WatchInterval: 20 * time.Millisecond,
+				WatchDebounce: 20 * time.Millisecond,
+			})
+		}()
+
+		So(waitForOutput(&stdout, "one\n"), ShouldBeTrue)
+
+		// A build failure is reported, without stopping the watch.
+		ioutil.WriteFile(src, []byte("package main\nfunc main() {"), 0644)
+		So(waitForOutput(&stderr, "Go build error"), ShouldBeTrue)
+
+		write("three")
+		So(waitForOutput(&stdout, "three\n"), ShouldBeTrue)
+		So(stderr.String(), ShouldContainSubstring, "restarting")
+
+		cancel()
+		So(<-done, ShouldEqual, context.Canceled)
+	})
+}
+
+const watchDirScript = `package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+func main() {
+	os.WriteFile(os.Args[1], []byte("output"), 0644)
+	fmt.Println("started")
+	time.Sleep(time.Hour)
+}
+`
+
+func TestWatchScriptDir(t *testing.T) {
+	tmpDir := filepath.Join("_test", "tmp")
+	opts := ScriptOptions{
+		Temp:          tmpDir,
+		GracePeriod:   time.Second,
+		WatchInterval: 20 * time.Millisecond,
+		WatchDebounce: 20 * time.Millisecond,
+	}
+
+	watchFor := func(dir string, args []string, opts ScriptOptions,
+		d time.Duration) string {
+		var stderr syncBuffer
+		opts.Stdout, opts.Stderr = &stderr, &stderr
+		ctx, cancel := context.WithTimeout(context.Background(), d)
+		defer cancel()
+		err := WatchScriptDir(ctx, dir, args, opts)
+		So(err, ShouldEqual, context.DeadlineExceeded)
+		return stderr.String()
+	}
+
+	Convey("Should not restart for files the script writes", t, func() {
+		dir := filepath.Join(tmpDir, "watch_dir")
+		os.RemoveAll(dir)
+		os.MkdirAll(dir, 0777)
+		defer os.RemoveAll(dir)
+		ioutil.WriteFile(filepath.Join(dir, "main.go"),
+			[]byte(watchDirScript), 0644)
+
+		out := watchFor(dir, []string{filepath.Join(dir, "output.txt")},
+			opts, 2*time.Second)
+		So(strings.Count(out, "started"), ShouldEqual, 1)
+		So(out, ShouldNotContainSubstring, "restarting")
+	})
+
+	Convey("Should not restart for files the build generates", t, func() {
+		dir := copyGenerateFixture()
+		opts := opts
+		opts.Generate = true
+
+		out := watchFor(dir, []string{}, opts, 2*time.Second)
+		So(out, ShouldContainSubstring, "exited with status 15")
+		So(out, ShouldNotContainSubstring, "restarting")
+	})
+}